@@ -0,0 +1,109 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// MarketStats contains aggregated trades of a market.
+type MarketStats struct {
+	// Count is the number of trades.
+	Count int
+	// Volume is the sum of trade volumes.
+	Volume float64
+	// VWAP is the volume weighted average price. It is zero, if Volume is zero.
+	VWAP float64
+}
+
+type aggregatedTrade struct {
+	at     time.Time
+	market string
+	price  float64
+	volume float64
+}
+
+// Aggregator maintains per-market trade stats over a sliding time window.
+// The window ends at the latest trade timestamp observed, not at the current time,
+// so out-of-order trades are accounted properly, and trades older than the window are ignored.
+// It is safe for concurrent use.
+type Aggregator struct {
+	window time.Duration
+	mut    sync.Mutex
+	// trades are sorted by time.
+	trades []aggregatedTrade
+	latest time.Time
+}
+
+// NewAggregator returns an Aggregator with given window.
+func NewAggregator(window time.Duration) *Aggregator {
+	return &Aggregator{window: window}
+}
+
+// Observe adds a trade to the stats. Trades are grouped by TradeData.MarketID.
+// Trade time is TradeData.Time(), or the current time, if TimestampMs is zero.
+// Trades with invalid price or volume are ignored.
+func (a *Aggregator) Observe(trade *Trade) {
+	price, err := parseNumber("price", trade.Data.Price)
+	if err != nil {
+		return
+	}
+	volume, err := parseNumber("volume", trade.Data.Volume)
+	if err != nil {
+		return
+	}
+	at := time.Now()
+	if trade.Data.TimestampMs != 0 {
+		at = trade.Data.Time()
+	}
+	a.mut.Lock()
+	defer a.mut.Unlock()
+	if !at.After(a.latest.Add(-a.window)) {
+		return
+	}
+	idx := sort.Search(len(a.trades), func(i int) bool {
+		return a.trades[i].at.After(at)
+	})
+	a.trades = append(a.trades, aggregatedTrade{})
+	copy(a.trades[idx+1:], a.trades[idx:])
+	a.trades[idx] = aggregatedTrade{at: at, market: trade.Data.MarketID, price: price, volume: volume}
+	if at.After(a.latest) {
+		a.latest = at
+		a.evict()
+	}
+}
+
+// evict removes trades, which are outside of the window.
+func (a *Aggregator) evict() {
+	cutoff := a.latest.Add(-a.window)
+	idx := sort.Search(len(a.trades), func(i int) bool {
+		return a.trades[i].at.After(cutoff)
+	})
+	if idx > 0 {
+		a.trades = append(a.trades[:0], a.trades[idx:]...)
+	}
+}
+
+// Snapshot returns current stats of all markets with trades in the window.
+func (a *Aggregator) Snapshot() map[string]MarketStats {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+	result := make(map[string]MarketStats)
+	notional := make(map[string]float64)
+	for _, trade := range a.trades {
+		stats := result[trade.market]
+		stats.Count++
+		stats.Volume += trade.volume
+		result[trade.market] = stats
+		notional[trade.market] += trade.price * trade.volume
+	}
+	for market, stats := range result {
+		if stats.Volume != 0 {
+			stats.VWAP = notional[market] / stats.Volume
+			result[market] = stats
+		}
+	}
+	return result
+}
@@ -0,0 +1,65 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+func aggTrade(market string, ms int64, price, volume string) *Trade {
+	var trade Trade
+	trade.Data.MarketID = market
+	trade.Data.TimestampMs = ms
+	trade.Data.Price = json.Number(price)
+	trade.Data.Volume = json.Number(volume)
+	return &trade
+}
+
+func TestAggregator(t *testing.T) {
+	agg := NewAggregator(time.Second * 10)
+	for _, trade := range []*Trade{
+		aggTrade("BTC_USD", 1000, "100", "1"),
+		aggTrade("BTC_USD", 5000, "200", "3"),
+		aggTrade("ETH_USD", 3000, "10", "2"),
+		aggTrade("ETH_USD", 2000, "20", "2"), // out of order, but in the window.
+		aggTrade("ETH_USD", 4000, "x", "1"),  // invalid.
+	} {
+		agg.Observe(trade)
+	}
+	expected := map[string]MarketStats{
+		"BTC_USD": {Count: 2, Volume: 4, VWAP: 175},
+		"ETH_USD": {Count: 2, Volume: 4, VWAP: 15},
+	}
+	checkStats(t, agg.Snapshot(), expected)
+
+	agg.Observe(aggTrade("BTC_USD", 12500, "300", "1")) // evicts trades at 1000 and 2000.
+	agg.Observe(aggTrade("ETH_USD", 2500, "50", "1"))   // older than the window.
+	expected = map[string]MarketStats{
+		"BTC_USD": {Count: 2, Volume: 4, VWAP: 225},
+		"ETH_USD": {Count: 1, Volume: 2, VWAP: 10},
+	}
+	checkStats(t, agg.Snapshot(), expected)
+
+	agg.Observe(aggTrade("BTC_USD", 30000, "1", "0"))
+	expected = map[string]MarketStats{
+		"BTC_USD": {Count: 1},
+	}
+	checkStats(t, agg.Snapshot(), expected)
+}
+
+func checkStats(t *testing.T, stats, expected map[string]MarketStats) {
+	t.Helper()
+	if len(stats) != len(expected) {
+		t.Errorf("expected %v, got %v", expected, stats)
+		return
+	}
+	for market, e := range expected {
+		s := stats[market]
+		if s.Count != e.Count || s.Volume != e.Volume || math.Abs(s.VWAP-e.VWAP) > 1e-9 {
+			t.Errorf("%s: expected %+v, got %+v", market, e, s)
+		}
+	}
+}
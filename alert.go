@@ -0,0 +1,95 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Direction is a direction, in which a price crosses a threshold.
+type Direction int
+
+const (
+	// DirectionUp means, that the price rises from below the threshold to or above it.
+	DirectionUp Direction = iota + 1
+	// DirectionDown means, that the price falls below the threshold.
+	DirectionDown
+	// DirectionAny means either DirectionUp or DirectionDown.
+	DirectionAny
+)
+
+// priceCrossDebounce is the min time between two crossings reported by WatchPriceCross.
+const priceCrossDebounce = time.Second
+
+// priceCross detects crossings of a threshold by a sequence of prices.
+type priceCross struct {
+	threshold float64
+	direction Direction
+	debounce  time.Duration
+	// above is true, if the last price was not below the threshold. known is false until the first price.
+	above, known bool
+	// last is the time of the last reported crossing.
+	last time.Time
+}
+
+// observe records a price received at given time, and returns true, if it crossed the threshold
+// in the watched direction, and the previous crossing was reported at least debounce ago.
+func (p *priceCross) observe(price float64, at time.Time) bool {
+	above := price >= p.threshold
+	if !p.known || above == p.above {
+		p.above, p.known = above, true
+		return false
+	}
+	p.above = above
+	if above && p.direction == DirectionDown || !above && p.direction == DirectionUp {
+		return false
+	}
+	if !p.last.IsZero() && at.Sub(p.last) < p.debounce {
+		return false
+	}
+	p.last = at
+	return true
+}
+
+// WatchPriceCross subscribes for trades and calls fn once per each crossing of the threshold by the price of given market,
+// like "BTC_USD", in given direction. The price is Data.Price, or Msg.Msg.Price, if the trade has no data.
+// Trades without a valid price are ignored. Crossings within a second after the reported one are ignored,
+// so that a price, which fluctuates around the threshold, does not fire fn on every trade.
+// fn is called synchronously, so it should return quickly.
+// WatchPriceCross blocks until ctx is done, and returns ctx.Err() then, or until the subscription fails.
+func (c *Client) WatchPriceCross(ctx context.Context, market string, threshold float64, direction Direction, fn func(*Trade)) error {
+	return c.watchPriceCross(ctx, market, &priceCross{threshold: threshold, direction: direction, debounce: priceCrossDebounce}, fn)
+}
+
+func (c *Client) watchPriceCross(ctx context.Context, market string, cross *priceCross, fn func(*Trade)) error {
+	if cross.direction < DirectionUp || cross.direction > DirectionAny {
+		return errors.Errorf("invalid direction %d", cross.direction)
+	}
+	tradeChan, stopChan := make(chan *Trade), make(chan bool)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- c.SubscribeTradesFiltered(tradeChan, stopChan, func(trade *Trade) bool {
+			return trade.Msg.MarketID == market
+		})
+	}()
+	for {
+		select {
+		case trade := <-tradeChan:
+			price, err := trade.price()
+			if err == nil && cross.observe(price, time.Now()) {
+				fn(trade)
+			}
+		case err := <-errChan:
+			return err
+		case <-ctx.Done():
+			close(stopChan)
+			if err := <-errChan; err != nil {
+				return err
+			}
+			return ctx.Err()
+		}
+	}
+}
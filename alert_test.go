@@ -0,0 +1,103 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	gosio "github.com/graarh/golang-socketio"
+	"github.com/pkg/errors"
+)
+
+func TestPriceCross(t *testing.T) {
+	start := time.Now()
+	prices := []float64{3990, 3995, 4005, 3990, 4010, 4020, 3980, 4000}
+	for _, tc := range []struct {
+		direction Direction
+		debounce  time.Duration
+		want      []int
+	}{
+		{direction: DirectionUp, want: []int{2, 4, 7}},
+		{direction: DirectionDown, want: []int{3, 6}},
+		{direction: DirectionAny, want: []int{2, 3, 4, 6, 7}},
+		{direction: DirectionAny, debounce: time.Second * 2, want: []int{2, 4, 6}},
+	} {
+		cross := &priceCross{threshold: 4000, direction: tc.direction, debounce: tc.debounce}
+		var got []int
+		for i, price := range prices {
+			if cross.observe(price, start.Add(time.Second*time.Duration(i))) {
+				got = append(got, i)
+			}
+		}
+		if len(got) != len(tc.want) {
+			t.Errorf("direction %d, debounce %v: expected crossings %v, got %v", tc.direction, tc.debounce, tc.want, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("direction %d, debounce %v: expected crossings %v, got %v", tc.direction, tc.debounce, tc.want, got)
+				break
+			}
+		}
+	}
+}
+
+func TestWatchPriceCross(t *testing.T) {
+	client := New()
+	newTestWsServer(t, client, func(ch *gosio.Channel) {
+		emitMessages(ch, "trades",
+			tradeMessage("bitfinex", "BTC_USD", "1", 3990),
+			tradeMessage("bitfinex", "ETH_USD", "2", 5000),
+			tradeMessage("bitfinex", "BTC_USD", "3", 4005),
+			tradeMessage("bitfinex", "BTC_USD", "4", 3990),
+			json.RawMessage(`{"message":{"coin":"BTC","exchange_id":"gdax","market_id":"BTC_USD","msg":{"short":"BTC","price":4010}}}`),
+			tradeMessage("bitfinex", "BTC_USD", "6", 4020),
+		)
+	})
+	var mut sync.Mutex
+	var fired []*Trade
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*500)
+	defer cancel()
+	err := client.WatchPriceCross(ctx, "BTC_USD", 4000, DirectionAny, func(trade *Trade) {
+		mut.Lock()
+		defer mut.Unlock()
+		fired = append(fired, trade)
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline error, got %v", err)
+	}
+	mut.Lock()
+	defer mut.Unlock()
+	// the crossing by trade 4 and the one without data are debounced.
+	if len(fired) != 1 || fired[0].Data.Raw.ID != "3" {
+		t.Errorf("expected a single crossing by trade 3, got %d", len(fired))
+	}
+	if err := client.WatchPriceCross(context.Background(), "BTC_USD", 4000, Direction(0), nil); err == nil {
+		t.Error("expected invalid direction error")
+	}
+}
+
+func TestWatchPriceCrossWithoutData(t *testing.T) {
+	client := New()
+	newTestWsServer(t, client, func(ch *gosio.Channel) {
+		emitMessages(ch, "trades",
+			json.RawMessage(`{"message":{"market_id":"BTC_USD","msg":{"price":4010}}}`),
+			json.RawMessage(`{"message":{"market_id":"BTC_USD","msg":{"price":3990}}}`),
+		)
+	})
+	fired := make(chan *Trade, 2)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*300)
+	defer cancel()
+	client.WatchPriceCross(ctx, "BTC_USD", 4000, DirectionDown, func(trade *Trade) {
+		fired <- trade
+	})
+	if len(fired) != 1 {
+		t.Errorf("expected 1 crossing, got %d", len(fired))
+	} else if trade := <-fired; trade.HasData || trade.Msg.Msg.Price != "3990" {
+		t.Errorf("unexpected trade %+v", trade)
+	}
+}
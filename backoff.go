@@ -0,0 +1,79 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff defines delays between retries of failed requests and automatic websocket reconnects.
+// Implementations must be safe for concurrent use, as a client uses the same Backoff for all its requests.
+type Backoff interface {
+	// NextDelay returns the delay before the given attempt, starting from 1.
+	NextDelay(attempt int) time.Duration
+	// Reset is called after a successful request or a received websocket message.
+	Reset()
+}
+
+// ConstantBackoff waits the same Delay before every attempt.
+type ConstantBackoff struct {
+	Delay time.Duration
+}
+
+// NextDelay implements Backoff.
+func (b ConstantBackoff) NextDelay(attempt int) time.Duration {
+	return b.Delay
+}
+
+// Reset implements Backoff.
+func (b ConstantBackoff) Reset() {}
+
+// ExponentialBackoff waits Initial before the first attempt, doubling the delay for every next one, up to Max.
+// Max of 0 means no limit.
+type ExponentialBackoff struct {
+	Initial time.Duration
+	Max     time.Duration
+}
+
+// NextDelay implements Backoff.
+func (b ExponentialBackoff) NextDelay(attempt int) time.Duration {
+	delay := b.Initial
+	for i := 1; i < attempt && delay > 0 && delay*2 > delay; i++ {
+		if delay *= 2; b.Max > 0 && delay >= b.Max {
+			break
+		}
+	}
+	if b.Max > 0 && delay > b.Max {
+		delay = b.Max
+	}
+	return delay
+}
+
+// Reset implements Backoff.
+func (b ExponentialBackoff) Reset() {}
+
+// JitterBackoff works like ExponentialBackoff, but randomizes every delay in range [delay/2, delay),
+// so that clients, which failed at the same time, do not retry simultaneously.
+type JitterBackoff struct {
+	ExponentialBackoff
+}
+
+// NextDelay implements Backoff.
+func (b JitterBackoff) NextDelay(attempt int) time.Duration {
+	delay := b.ExponentialBackoff.NextDelay(attempt)
+	if half := delay / 2; half > 0 {
+		delay = half + time.Duration(rand.Int63n(int64(half)))
+	}
+	return delay
+}
+
+// maxReconnectDelay is the max delay between failed websocket dials, if no Backoff is set.
+const maxReconnectDelay = 30 * time.Second
+
+var (
+	// defaultRetryBackoff is used for retries, if no Backoff is set.
+	defaultRetryBackoff Backoff = ExponentialBackoff{Initial: retryDelay}
+	// defaultReconnectBackoff is used for reconnects after failed websocket dials, if no Backoff is set.
+	defaultReconnectBackoff Backoff = ExponentialBackoff{Initial: retryDelay, Max: maxReconnectDelay}
+)
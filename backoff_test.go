@@ -0,0 +1,200 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	gosio "github.com/graarh/golang-socketio"
+	"github.com/graarh/golang-socketio/transport"
+)
+
+// testBackoff records requested attempts and returns a fixed delay.
+type testBackoff struct {
+	delay    time.Duration
+	mut      sync.Mutex
+	attempts []int
+	resets   int
+}
+
+func (b *testBackoff) NextDelay(attempt int) time.Duration {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	b.attempts = append(b.attempts, attempt)
+	return b.delay
+}
+
+func (b *testBackoff) Reset() {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	b.resets++
+}
+
+func (b *testBackoff) state() ([]int, int) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	return append([]int(nil), b.attempts...), b.resets
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	b := ExponentialBackoff{Initial: time.Second, Max: time.Second * 5}
+	expected := []time.Duration{time.Second, time.Second * 2, time.Second * 4, time.Second * 5, time.Second * 5}
+	for i, exp := range expected {
+		if d := b.NextDelay(i + 1); d != exp {
+			t.Errorf("attempt %d: expected %v, got %v", i+1, exp, d)
+		}
+	}
+	if d := (ExponentialBackoff{Initial: time.Second}).NextDelay(1000); d <= 0 {
+		t.Errorf("unexpected delay on overflow: %v", d)
+	}
+	j := JitterBackoff{ExponentialBackoff{Initial: time.Second}}
+	for i := 0; i < 10; i++ {
+		if d := j.NextDelay(2); d < time.Second || d >= time.Second*2 {
+			t.Errorf("jitter delay out of range: %v", d)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	var requests int32
+	b := &testBackoff{}
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"BTCPrice":4000}`))
+	}, WithRetryBudget(10, time.Minute), WithBackoff(b))
+	if _, err := client.Global(); err != nil {
+		t.Fatal(err)
+	}
+	attempts, resets := b.state()
+	if len(attempts) != 2 || attempts[0] != 1 || attempts[1] != 2 {
+		t.Errorf("unexpected attempts %v", attempts)
+	}
+	if resets != 1 {
+		t.Errorf("expected 1 reset, got %d", resets)
+	}
+}
+
+func TestReconnectBackoff(t *testing.T) {
+	b := &testBackoff{}
+	client := New(WithStallTimeout(time.Millisecond*100), WithBackoff(b))
+	var connections int32
+	newTestWsServer(t, client, func(ch *gosio.Channel) {
+		atomic.AddInt32(&connections, 1) // stay silent, so that the client reconnects on stall.
+	})
+	stopChan, doneChan := make(chan bool), make(chan error)
+	go func() {
+		doneChan <- client.SubscribeTrades(make(chan *Trade), stopChan)
+	}()
+	for atomic.LoadInt32(&connections) < 3 {
+		time.Sleep(time.Millisecond * 10)
+	}
+	close(stopChan)
+	if err := <-doneChan; err != nil {
+		t.Error(err)
+	}
+	attempts, resets := b.state()
+	for i, attempt := range attempts {
+		if attempt != i+1 {
+			t.Errorf("unexpected attempts %v", attempts)
+			break
+		}
+	}
+	if resets != 0 {
+		t.Errorf("expected no resets, got %d", resets)
+	}
+}
+
+func TestReconnectBackoffStop(t *testing.T) {
+	client := New(WithStallTimeout(time.Millisecond*100), WithBackoff(ConstantBackoff{Delay: time.Hour}))
+	newTestWsServer(t, client, func(ch *gosio.Channel) {})
+	stopChan, doneChan := make(chan bool), make(chan error)
+	go func() {
+		doneChan <- client.SubscribeTrades(make(chan *Trade), stopChan)
+	}()
+	time.Sleep(time.Millisecond * 300) // the client is waiting for a reconnect now.
+	select {
+	case stopChan <- true:
+	case <-time.After(time.Second):
+		t.Fatal("subscription does not read stopChan while waiting")
+	}
+	select {
+	case err := <-doneChan:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Error("subscription did not stop")
+	}
+}
+
+func TestReconnectBackoffDialError(t *testing.T) {
+	b := &testBackoff{}
+	client := New(WithBackoff(b))
+	tr := &flakyTransport{WebsocketTransport: transport.GetDefaultWebsocketTransport(), failing: map[int32]bool{2: true, 3: true}}
+	client.wsTransport = tr
+	newTestWsServer(t, client, func(ch *gosio.Channel) {
+		emitTrades(ch, 1)
+	})
+	tradeChan, stopChan, errChan, doneChan := make(chan *Trade), make(chan bool), make(chan error, 10), make(chan error)
+	go func() {
+		doneChan <- client.SubscribeTradesWithErrors(tradeChan, stopChan, errChan)
+	}()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-tradeChan:
+		case <-time.After(time.Second * 2):
+			t.Fatalf("no trade on connection %d", i+1)
+		}
+		if i == 0 {
+			stopChan <- false // reconnect, while the server is unavailable.
+		}
+	}
+	close(stopChan)
+	if err := <-doneChan; err != nil {
+		t.Error(err)
+	}
+	if n := len(errChan); n != 2 {
+		t.Errorf("expected 2 dial errors, got %d", n)
+	}
+	if n := atomic.LoadInt32(&tr.connects); n != 4 {
+		t.Errorf("expected 4 connects, got %d", n)
+	}
+	attempts, resets := b.state()
+	if len(attempts) != 2 || attempts[0] != 1 || attempts[1] != 2 {
+		t.Errorf("unexpected attempts %v", attempts)
+	}
+	if resets != 1 {
+		t.Errorf("expected 1 reset, got %d", resets)
+	}
+	// without an error channel, a failed reconnect terminates the subscription.
+	client = New(WithBackoff(b))
+	client.wsTransport = &flakyTransport{WebsocketTransport: transport.GetDefaultWebsocketTransport(), failing: map[int32]bool{2: true}}
+	newTestWsServer(t, client, func(ch *gosio.Channel) {})
+	stopChan = make(chan bool)
+	go func() {
+		doneChan <- client.SubscribeTrades(make(chan *Trade), stopChan)
+	}()
+	stopChan <- false
+	select {
+	case err := <-doneChan:
+		if err == nil || !strings.Contains(err.Error(), "connect 2 failed") {
+			t.Errorf("expected dial error, got %v", err)
+		}
+	case <-time.After(time.Second * 2):
+		t.Fatal("subscription did not return the dial error")
+	}
+	// the initial dial is never retried.
+	client = New(WithBackoff(b))
+	client.wsTransport = &flakyTransport{WebsocketTransport: transport.GetDefaultWebsocketTransport(), failing: map[int32]bool{1: true}}
+	if err := client.SubscribeTrades(make(chan *Trade), make(chan bool)); err == nil {
+		t.Error("expected dial error")
+	}
+}
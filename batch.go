@@ -0,0 +1,135 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// BatchError is returned by batch requests, if some of them failed.
+// It maps a failed symbol to its error.
+type BatchError map[string]error
+
+func (e BatchError) Error() string {
+	symbols := make([]string, 0, len(e))
+	for symb := range e {
+		symbols = append(symbols, symb)
+	}
+	sort.Strings(symbols)
+	parts := make([]string, 0, len(symbols))
+	for _, symb := range symbols {
+		parts = append(parts, fmt.Sprintf("%s: %v", symb, e[symb]))
+	}
+	return "batch request failed: " + strings.Join(parts, "; ")
+}
+
+// Is reports whether any of the errors matches target,
+// so that errors.Is(err, context.Canceled) holds for batches aborted by ctx.
+func (e BatchError) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Pages requests /page path for given symbols in parallel.
+// Max number of parallel requests is set via WithBatchConcurrency.
+// It returns pages for all the symbols, that were fetched successfully.
+// If some requests failed, or were not made because ctx was canceled,
+// BatchError with an error for each such symbol is returned together with the pages.
+// Canceling ctx aborts the requests in progress, so that Pages returns promptly with the pages fetched so far.
+func (c *Client) Pages(ctx context.Context, symbols []string) (map[string]*Page, error) {
+	results, err := c.batch(ctx, symbols, func(symb string) (interface{}, error) {
+		return c.page(ctx, symb)
+	})
+	pages := make(map[string]*Page, len(results))
+	for symb, res := range results {
+		pages[symb] = res.(*Page)
+	}
+	return pages, err
+}
+
+// Histories requests /history path for given symbols and interval in parallel.
+// The interval is validated before making any requests, ErrInvalidInterval is returned, if it is not valid.
+// Results and errors are handled the same way, as in Pages.
+func (c *Client) Histories(ctx context.Context, symbols []string, interval string) (map[string]*History, error) {
+	if err := validateInterval(interval); err != nil {
+		return nil, err
+	}
+	results, err := c.batch(ctx, symbols, func(symb string) (interface{}, error) {
+		return c.symbolHistory(ctx, symb, interval)
+	})
+	histories := make(map[string]*History, len(results))
+	for symb, res := range results {
+		histories[symb] = res.(*History)
+	}
+	return histories, err
+}
+
+// batch calls fetch for given symbols in parallel, running at most c.batchConcurrency calls at once.
+// It returns the results of successful calls, and BatchError, if some of them failed or were not made.
+// When ctx is done, no new calls are made, and the running ones are expected to abort, as fetch uses ctx
+// for waiting for a request slot, for http calls, and for delays between retries.
+func (c *Client) batch(ctx context.Context, symbols []string, fetch func(symb string) (interface{}, error)) (map[string]interface{}, error) {
+	type result struct {
+		symb  string
+		value interface{}
+		err   error
+	}
+	symbChan, resultChan := make(chan string), make(chan result)
+	var wg sync.WaitGroup
+	for i := 0; i < c.batchConcurrency && i < len(symbols); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for symb := range symbChan {
+				if ctx.Err() != nil {
+					// the symbol was taken, when ctx was already done.
+					resultChan <- result{symb: symb, err: ctx.Err()}
+					continue
+				}
+				value, err := fetch(symb)
+				resultChan <- result{symb: symb, value: value, err: err}
+			}
+		}()
+	}
+	go func() {
+		defer close(symbChan)
+		for _, symb := range symbols {
+			select {
+			case symbChan <- symb:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(resultChan)
+	}()
+	results, errs := make(map[string]interface{}), make(BatchError)
+	for res := range resultChan {
+		if res.err != nil {
+			errs[res.symb] = res.err
+		} else {
+			results[res.symb] = res.value
+		}
+	}
+	for _, symb := range symbols {
+		if _, found := results[symb]; !found && errs[symb] == nil {
+			errs[symb] = ctx.Err()
+		}
+	}
+	if len(errs) > 0 {
+		return results, errs
+	}
+	return results, nil
+}
@@ -0,0 +1,257 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestPages(t *testing.T) {
+	const concurrency = 2
+	var inFlight, maxInFlight int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		cur := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if cur <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, cur) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond * 20)
+		symb := strings.TrimPrefix(r.URL.Path, "/page/")
+		if symb == "BAD" {
+			w.Write([]byte(`garbage`))
+			return
+		}
+		w.Write([]byte(`{"id":"` + symb + `"}`))
+	}, WithBatchConcurrency(concurrency))
+	symbols := []string{"BTC", "ETH", "BAD", "LTC", "XMR", "ZEC"}
+	pages, err := client.Pages(context.Background(), symbols)
+	batchErr, ok := err.(BatchError)
+	if !ok {
+		t.Errorf("expected BatchError, got %v", err)
+		return
+	}
+	if len(batchErr) != 1 || batchErr["BAD"] == nil {
+		t.Errorf("expected an error for BAD, got %v", batchErr)
+	}
+	if len(pages) != len(symbols)-1 {
+		t.Errorf("expected %d pages, got %d", len(symbols)-1, len(pages))
+	}
+	for symb, page := range pages {
+		if page.ID != symb {
+			t.Errorf("unexpected page %q for %s", page.ID, symb)
+		}
+	}
+	if max := atomic.LoadInt32(&maxInFlight); max > concurrency {
+		t.Errorf("expected at most %d parallel requests, got %d", concurrency, max)
+	}
+}
+
+func TestPagesCanceled(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	pages, err := client.Pages(ctx, []string{"BTC", "ETH"})
+	if batchErr, ok := err.(BatchError); !ok || len(batchErr) != 2 {
+		t.Errorf("expected errors for all symbols, got %v", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if len(pages) != 0 {
+		t.Errorf("expected no pages, got %v", pages)
+	}
+}
+
+func TestMaxConcurrency(t *testing.T) {
+	const concurrency = 2
+	var inFlight, maxInFlight int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		cur := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if cur <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, cur) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond * 20)
+		w.Write([]byte(`{"id":"` + strings.TrimPrefix(r.URL.Path, "/page/") + `"}`))
+	}, WithMaxConcurrency(concurrency), WithBatchConcurrency(8))
+	symbols := []string{"BTC", "ETH", "LTC", "XMR", "ZEC", "DASH", "DOGE", "XRP"}
+	pages, err := client.Pages(context.Background(), symbols)
+	if err != nil {
+		t.Error(err)
+	} else if len(pages) != len(symbols) {
+		t.Errorf("expected %d pages, got %d", len(symbols), len(pages))
+	}
+	if max := atomic.LoadInt32(&maxInFlight); max > concurrency {
+		t.Errorf("expected at most %d requests in flight, got %d", concurrency, max)
+	}
+	// a request waiting for a slot is aborted, when its context is done.
+	client.inFlight <- struct{}{}
+	client.inFlight <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	if _, err := client.page(ctx, "BTC"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline error, got %v", err)
+	}
+}
+
+func TestHistories(t *testing.T) {
+	const concurrency = 3
+	var requests, inFlight, maxInFlight int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		cur := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if cur <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, cur) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond * 20)
+		if !strings.HasPrefix(r.URL.Path, "/history/1day/") || strings.HasSuffix(r.URL.Path, "/BAD") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"price":[[1500000000000,4000]]}`))
+	}, WithBatchConcurrency(concurrency))
+	if _, err := client.Histories(context.Background(), []string{"BTC"}, "2day"); !errors.Is(err, ErrInvalidInterval) {
+		t.Errorf("expected invalid interval error, got %v", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 0 {
+		t.Errorf("expected no requests for an invalid interval, got %d", n)
+	}
+	symbols := []string{"btc", "ETH", "BAD", "LTC", "XMR", "ZEC", "DASH"}
+	histories, err := client.Histories(context.Background(), symbols, HistoryInterval1Day)
+	batchErr, ok := err.(BatchError)
+	if !ok {
+		t.Fatalf("expected BatchError, got %v", err)
+	}
+	if len(batchErr) != 1 || !errors.Is(batchErr["BAD"], ErrHTTPStatus) {
+		t.Errorf("expected an http status error for BAD, got %v", batchErr)
+	}
+	if len(histories) != len(symbols)-1 {
+		t.Errorf("expected %d histories, got %d", len(symbols)-1, len(histories))
+	}
+	if hist := histories["btc"]; hist == nil || len(hist.Price) != 1 {
+		t.Errorf("unexpected history for btc: %v", hist)
+	}
+	if max := atomic.LoadInt32(&maxInFlight); max > concurrency {
+		t.Errorf("expected at most %d parallel requests, got %d", concurrency, max)
+	}
+}
+
+func TestPagesCancelMidBatch(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		symb := strings.TrimPrefix(r.URL.Path, "/page/")
+		if symb == "BTC" || symb == "ETH" {
+			w.Write([]byte(`{"id":"` + symb + `"}`))
+			return
+		}
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second * 10):
+		}
+	}, WithBatchConcurrency(2), WithRetryBudget(10, time.Minute))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+	defer cancel()
+	symbols := []string{"BTC", "ETH", "LTC", "XMR", "ZEC", "DASH"}
+	start := time.Now()
+	pages, err := client.Pages(ctx, symbols)
+	if elapsed := time.Since(start); elapsed > time.Second*2 {
+		t.Errorf("batch did not return promptly, took %v", elapsed)
+	}
+	if len(pages) != 2 || pages["BTC"] == nil || pages["ETH"] == nil {
+		t.Errorf("expected BTC and ETH pages, got %v", pages)
+	}
+	batchErr, ok := err.(BatchError)
+	if !ok {
+		t.Fatalf("expected BatchError, got %v", err)
+	}
+	for _, symb := range symbols[2:] {
+		if batchErr[symb] == nil {
+			t.Errorf("expected an error for %s", symb)
+		}
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestSharedRequestCancel(t *testing.T) {
+	started := make(chan struct{}, 1)
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second * 10):
+		}
+	}, WithTimeout(time.Millisecond*500))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go client.page(ctx, "BTC")
+	<-started
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer waitCancel()
+	start := time.Now()
+	if _, err := client.page(waitCtx, "BTC"); !errors.Is(err, ErrNetwork) {
+		t.Errorf("expected network error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("waiting for a shared request was not aborted, took %v", elapsed)
+	}
+}
+
+func TestSharedRequestFirstCallerCancel(t *testing.T) {
+	var requests int32
+	started := make(chan struct{}, 1)
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		started <- struct{}{}
+		time.Sleep(time.Millisecond * 200)
+		w.Write([]byte(`{"id":"BTC","price_usd":4000}`))
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := client.page(ctx, "BTC")
+		firstErr <- err
+	}()
+	<-started
+	type result struct {
+		page *Page
+		err  error
+	}
+	secondRes := make(chan result, 1)
+	go func() {
+		page, err := client.page(context.Background(), "BTC")
+		secondRes <- result{page: page, err: err}
+	}()
+	time.Sleep(time.Millisecond * 50)
+	cancel()
+	if err := <-firstErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the first caller to be canceled, got %v", err)
+	}
+	if res := <-secondRes; res.err != nil {
+		t.Errorf("expected the second caller to succeed, got %v", res.err)
+	} else if res.page.ID != "BTC" {
+		t.Errorf("unexpected page %+v", res.page)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("expected 1 shared request, got %d", n)
+	}
+}
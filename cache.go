@@ -0,0 +1,82 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// cache keeps raw replies for API paths.
+// Raw json is stored instead of decoded values, so that callers never share the same slices and structs.
+// Expired entries with Last-Modified header are kept to revalidate them with If-Modified-Since.
+type cache struct {
+	ttl     time.Duration
+	exclude []string
+
+	mut     sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	data    []byte
+	fetched time.Time
+	expires time.Time
+	// lastModified is the Last-Modified header of the reply, if any.
+	lastModified string
+}
+
+func newCache(ttl time.Duration, exclude []string) *cache {
+	paths := make([]string, 0, len(exclude))
+	for _, path := range exclude {
+		paths = append(paths, strings.Trim(path, "/"))
+	}
+	return &cache{ttl: ttl, exclude: paths, entries: make(map[string]cacheEntry)}
+}
+
+// cacheable returns false for the excluded paths and their subpaths.
+func (c *cache) cacheable(path string) bool {
+	for _, excl := range c.exclude {
+		if path == excl || strings.HasPrefix(path, excl+"/") {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *cache) get(path string) (cacheEntry, bool) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	entry, found := c.entries[path]
+	if !found {
+		return cacheEntry{}, false
+	}
+	if time.Now().After(entry.expires) {
+		if len(entry.lastModified) == 0 {
+			delete(c.entries, path)
+		}
+		return cacheEntry{}, false
+	}
+	return entry, true
+}
+
+// stale returns an entry for path, which may be revalidated, even if it is expired.
+func (c *cache) stale(path string) (cacheEntry, bool) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	entry, found := c.entries[path]
+	if !found || len(entry.lastModified) == 0 {
+		return cacheEntry{}, false
+	}
+	return entry, true
+}
+
+// set stores data for path and returns the time it was stored at, which is the fetch time of the entry.
+func (c *cache) set(path string, data []byte, lastModified string) time.Time {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	now := time.Now()
+	c.entries[path] = cacheEntry{data: data, fetched: now, expires: now.Add(c.ttl), lastModified: lastModified}
+	return now
+}
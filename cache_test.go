@@ -0,0 +1,111 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	var requests int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte(`[]`))
+	}, WithCache(time.Millisecond*200, "front"))
+	for i := 0; i < 3; i++ {
+		if _, err := client.Coins(); err != nil {
+			t.Error(err)
+		}
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("expected 1 request, got %d", n)
+	}
+	time.Sleep(time.Millisecond * 300)
+	if _, err := client.Coins(); err != nil {
+		t.Error(err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("expected a request after expiry, got %d requests", n)
+	}
+	for i := 0; i < 2; i++ {
+		client.Front()
+		client.FrontXCP()
+	}
+	if n := atomic.LoadInt32(&requests); n != 6 {
+		t.Errorf("excluded paths must not be cached, got %d requests", n)
+	}
+}
+
+func TestCacheExclude(t *testing.T) {
+	c := newCache(time.Minute, []string{"/front/", "history/"})
+	for path, want := range map[string]bool{"front": false, "front/xcp": false, "history/1day/BTC": false, "frontier": true, "global": true} {
+		if got := c.cacheable(path); got != want {
+			t.Errorf("%s: expected %v, got %v", path, want, got)
+		}
+	}
+}
+
+func TestCacheConcurrent(t *testing.T) {
+	var requests int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		time.Sleep(time.Millisecond * 100)
+		w.Write([]byte(`{"BTCPrice":4000}`))
+	}, WithCache(time.Minute))
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if gl, err := client.Global(); err != nil {
+				t.Error(err)
+			} else if gl.BTCPrice != "4000" {
+				t.Errorf("unexpected price %q", gl.BTCPrice)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("expected 1 request, got %d", n)
+	}
+}
+
+func TestCacheConditionalGet(t *testing.T) {
+	const lastModified = "Mon, 02 Jan 2017 15:04:05 GMT"
+	var requests int32
+	var ifModifiedSince string
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		ifModifiedSince = r.Header.Get("If-Modified-Since")
+		if atomic.AddInt32(&requests, 1) > 1 && ifModifiedSince == lastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Last-Modified", lastModified)
+		w.Write([]byte(`[{"name":"Bitcoin","symbol":"BTC"}]`))
+	}, WithCache(time.Millisecond*50))
+	for i := 0; i < 3; i++ {
+		if i > 0 {
+			time.Sleep(time.Millisecond * 100)
+		}
+		mappings, err := client.Map()
+		if err != nil {
+			t.Errorf("%d: %v", i, err)
+		} else if len(mappings) != 1 || mappings[0].Symbol != "BTC" {
+			t.Errorf("%d: unexpected mappings %v", i, mappings)
+		}
+		expected := lastModified
+		if i == 0 {
+			expected = ""
+		}
+		if ifModifiedSince != expected {
+			t.Errorf("%d: expected If-Modified-Since %q, got %q", i, expected, ifModifiedSince)
+		}
+	}
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Errorf("expected 3 requests, got %d", n)
+	}
+}
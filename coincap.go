@@ -7,13 +7,23 @@
 package coincap
 
 import (
+	"compress/gzip"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	gosio "github.com/graarh/golang-socketio"
 	"github.com/graarh/golang-socketio/transport"
 	"github.com/pkg/errors"
+	"golang.org/x/sync/singleflight"
 )
 
 // HistoryInterval* consts are used in History() request.
@@ -27,25 +37,92 @@ const (
 	HistoryInterval365Days = "365day"
 )
 
+// ErrInvalidInterval is returned by History(), if the interval is not one of the HistoryInterval* consts.
+var ErrInvalidInterval = errors.New("invalid history interval")
+
+// ValidIntervals returns all the valid history intervals, except HistoryIntervalAll.
+func ValidIntervals() []string {
+	return []string{
+		HistoryInterval1Day,
+		HistoryInterval7Days,
+		HistoryInterval30Days,
+		HistoryInterval90Days,
+		HistoryInterval180Days,
+		HistoryInterval365Days,
+	}
+}
+
+func validateInterval(interval string) error {
+	if interval == HistoryIntervalAll {
+		return nil
+	}
+	for _, valid := range ValidIntervals() {
+		if interval == valid {
+			return nil
+		}
+	}
+	return errors.Wrap(ErrInvalidInterval, interval)
+}
+
 const (
 	cAPIURL = "https://coincap.io/"
 	cWsURL  = "coincap.io"
+
+	version          = "0.1.0"
+	defaultUserAgent = "coincap-go/" + version
+	defaultTimeout   = 30 * time.Second
+
+	defaultBatchConcurrency = 4
+	defaultDialTimeout      = 10 * time.Second
 )
 
+// ErrInvalidPaging is returned by CoinsPaged, if offset or limit is negative.
+var ErrInvalidPaging = errors.New("invalid paging parameters")
+
+// ErrInvalidSymbol is returned, if a symbol is empty or has invalid format.
+var ErrInvalidSymbol = errors.New("invalid symbol")
+
+// maxSymbolLength is the max length of a symbol accepted by ValidSymbol.
+const maxSymbolLength = 32
+
+// ValidSymbol returns an error wrapping ErrInvalidSymbol, if symb is not a valid coincap symbol:
+// it must be 1 to 32 latin letters or digits. The symbol is checked as is, so surrounding spaces are an error.
+// Page, History, and other methods, which take a symbol, validate it after normalization,
+// unless it is disabled with WithSymbolNormalization.
+func ValidSymbol(symb string) error {
+	if len(symb) == 0 || len(symb) > maxSymbolLength {
+		return errors.Wrapf(ErrInvalidSymbol, "%q", symb)
+	}
+	for _, r := range symb {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return errors.Wrapf(ErrInvalidSymbol, "%q", symb)
+		}
+	}
+	return nil
+}
+
+// ErrClosed is returned by requests made after Close.
+var ErrClosed = errors.New("client closed")
+
+// ErrEmptyResponse is returned, if coincap replied with an empty body or 'null'.
+// Empty arrays and objects are valid replies.
+var ErrEmptyResponse = errors.New("empty response")
+
 // Front is a reply for /front path.
+// Field tags match coincap names, so a decoded Front is encoded back in the same form.
 type Front struct {
-	Long          string
-	Short         string
-	Shapeshift    bool
-	Price         json.Number
-	Cap24hrChange json.Number
-	Mktcap        json.Number
-	Perc          json.Number
-	Supply        json.Number
-	USDVolume     json.Number
-	Volume        json.Number
-	VwapData      *json.Number
-	VwapDataBTC   *json.Number
+	Long          string       `json:"long"`
+	Short         string       `json:"short"`
+	Shapeshift    bool         `json:"shapeshift"`
+	Price         json.Number  `json:"price"`
+	Cap24hrChange json.Number  `json:"cap24hrChange"`
+	Mktcap        json.Number  `json:"mktcap"`
+	Perc          json.Number  `json:"perc"`
+	Supply        json.Number  `json:"supply"`
+	USDVolume     json.Number  `json:"usdVolume"`
+	Volume        json.Number  `json:"volume"`
+	VwapData      *json.Number `json:"vwapData"`
+	VwapDataBTC   *json.Number `json:"vwapDataBTC"`
 }
 
 // TradeData is a piece of information about a trade.
@@ -55,12 +132,12 @@ type TradeData struct {
 	Price      json.Number
 	Raw        struct {
 		ID        string
-		TimeStamp time.Time
+		TimeStamp Timestamp
 		Quantity  json.Number
 		Price     json.Number
 		Total     json.Number
-		FillType  string
-		OrderType string
+		FillType  FillType
+		OrderType OrderType
 	}
 	TimestampMs int64 `json:"timestamp_ms"`
 	Volume      json.Number
@@ -78,6 +155,9 @@ type TradeMessage struct {
 type Trade struct {
 	Msg  TradeMessage
 	Data TradeData
+	// HasData is false, if the message had no trade data, or it was null, and Data is zero.
+	// Messages with malformed trade data are not delivered, but reported as ErrDecode errors.
+	HasData bool
 }
 
 // Global is a websocket message from 'global' channel, and a reply for /global path.
@@ -123,45 +203,271 @@ type Page struct {
 }
 
 // History is a reply for /history path.
+// Each series contains [timestamp ms, value] pairs in the order returned by the server. See Sorted.
 type History struct {
 	Price     [][2]json.Number
 	MarketCap [][2]json.Number `json:"market_cap"`
 	Volume    [][2]json.Number
 }
 
+// API is the set of coincap requests implemented by Client.
+// It may be used to substitute Client with a fake implementation in tests.
+type API interface {
+	Coins() ([]string, error)
+	CoinsXCP() ([]string, error)
+	CoinsXCPAll() ([]string, error)
+	Map() ([]Mapping, error)
+	Global() (Global, error)
+	Front() ([]Front, error)
+	FrontXCP() ([]Front, error)
+	Page(symb string) (*Page, error)
+	History(symb, interval string) (*History, error)
+	SubscribeTrades(dataChan chan<- *Trade, stopChan <-chan bool) error
+}
+
+var _ API = (*Client)(nil)
+
 // Client send API requests and parses responses.
 // It also can be used for subscription on websocket.
 type Client struct {
-	cl *http.Client
+	cl        *http.Client
+	apiURL    string
+	userAgent string
+	timeout   time.Duration
+	observer  func(path string, duration time.Duration, err error)
+	metrics   Metrics
+	wsURL     string
+	logger    Logger
+	proxy     *url.URL
+	tlsConfig *tls.Config
+	// insecureSkipVerify disables verification of server certificates. For tests only.
+	insecureSkipVerify bool
+	// transport, if not nil, is used instead of a new one.
+	transport http.RoundTripper
+	// ownTransport is true, if the transport was created by the client, so it may be closed.
+	ownTransport bool
+	// batchConcurrency is the max number of parallel requests in batch methods.
+	batchConcurrency int
+	stallTimeout     time.Duration
+	dialTimeout      time.Duration
+	cache            *cache
+	strictDecoding   bool
+	dropPolicy       DropPolicy
+	// normalizeNumbers enables replacing empty and invalid json.Number values in replies with NumberSentinel.
+	normalizeNumbers bool
+	// decoder, if not nil, is used to decode replies and websocket messages instead of encoding/json.
+	decoder Decoder
+	// backoff, if not nil, defines delays between retries and automatic reconnects.
+	backoff Backoff
+	// retryBudget, if not nil, enables retries of failed requests.
+	retryBudget *retryBudget
+	// maxRetryAfter caps delays requested by coincap via Retry-After header.
+	maxRetryAfter time.Duration
+	// endpointTimeouts override timeout for the paths and their subpaths.
+	endpointTimeouts map[string]time.Duration
+	// reconnectHook, if not nil, is called before every reconnect.
+	reconnectHook func(ctx context.Context) error
+	// sendTimeout, if positive, limits the time a subscription waits for the consumer to receive a message.
+	sendTimeout time.Duration
+	// headers are sent with every http request.
+	headers http.Header
+	// inFlight, if not nil, is a semaphore limiting the number of in-flight requests.
+	inFlight chan struct{}
+	// maxSkew is the max trade time skew, which is not logged. 0 disables logging.
+	maxSkew time.Duration
+	// connStateHandler, if not nil, is called on subscription state changes.
+	connStateHandler func(state ConnState)
+	// requestIDFunc, if not nil, generates IDs for X-Request-ID header.
+	requestIDFunc func() string
+	// requestObserver is like observer, but also receives request IDs.
+	requestObserver func(RequestInfo)
+	// drainTimeout is the max time to deliver pending messages after a stop signal. 0 disables draining.
+	drainTimeout time.Duration
+	// wsTransport is used to dial websocket connections. If nil, the default websocket transport is used.
+	wsTransport transport.Transport
+	// rawSymbols disables symbol normalization.
+	rawSymbols bool
+	// dedupSize is the number of recent trades remembered to suppress duplicates. 0 disables deduplication.
+	dedupSize int
+	stats     *subscriptionCounters
+	// group deduplicates concurrent requests of the same path.
+	group singleflight.Group
+	// shared keeps contexts of the requests deduplicated by group.
+	shared sharedRequests
+	// symbols keeps the index of /map path for HasSymbol.
+	symbols symbolIndexCache
+	// closeChan is closed by Close.
+	closeChan chan struct{}
+	closeOnce sync.Once
+	// err is a configuration error, returned by all requests.
+	err error
+}
+
+// New returns new Client configured with given options.
+func New(opts ...Option) *Client {
+	c := &Client{
+		apiURL:    cAPIURL,
+		userAgent: defaultUserAgent,
+		timeout:   defaultTimeout,
+		wsURL:     gosio.GetUrl(cWsURL, 443, true),
+		logger:    nopLogger{},
+
+		batchConcurrency: defaultBatchConcurrency,
+		dialTimeout:      defaultDialTimeout,
+		maxRetryAfter:    defaultMaxRetryAfter,
+		closeChan:        make(chan struct{}),
+		stats:            &subscriptionCounters{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.cl == nil {
+		tr := c.transport
+		if tr == nil {
+			tr, c.ownTransport = c.makeTransport(), true
+		}
+		c.cl = &http.Client{Timeout: c.clientTimeout(), Transport: tr}
+	} else {
+		// the timeout of the client set with WithHTTPClient is used instead.
+		c.timeout = 0
+	}
+	return c
+}
+
+// clientTimeout returns the timeout of the http client. If endpoint timeouts are set, they are applied
+// per request, so the client timeout must not be less than any of them.
+func (c *Client) clientTimeout() time.Duration {
+	timeout := c.timeout
+	for _, d := range c.endpointTimeouts {
+		if timeout == 0 || d == 0 {
+			return 0
+		}
+		if d > timeout {
+			timeout = d
+		}
+	}
+	return timeout
+}
+
+// requestTimeout returns the timeout for given path: the one of the longest matching endpoint, or the default one.
+func (c *Client) requestTimeout(path string) time.Duration {
+	if idx := strings.IndexByte(path, '?'); idx >= 0 {
+		path = path[:idx]
+	}
+	timeout, matched := c.timeout, ""
+	for endpoint, d := range c.endpointTimeouts {
+		if (path == endpoint || strings.HasPrefix(path, endpoint+"/")) && len(endpoint) > len(matched) {
+			timeout, matched = d, endpoint
+		}
+	}
+	return timeout
 }
 
-// New returns new Client.
-func New() *Client {
-	return &Client{cl: &http.Client{}}
+// withRequestTimeout returns ctx with the timeout for given path, if endpoint timeouts are set.
+// Otherwise the timeout is applied by the http client.
+func (c *Client) withRequestTimeout(ctx context.Context, path string) (context.Context, context.CancelFunc) {
+	if len(c.endpointTimeouts) > 0 {
+		if d := c.requestTimeout(path); d > 0 {
+			return context.WithTimeout(ctx, d)
+		}
+	}
+	return ctx, func() {}
+}
+
+// makeTransport returns a new transport, so that Close does not affect connections of other clients.
+func (c *Client) makeTransport() http.RoundTripper {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if c.proxy != nil {
+		tr.Proxy = http.ProxyURL(c.proxy)
+	}
+	if c.tlsConfig != nil {
+		tr.TLSClientConfig = c.tlsConfig
+	}
+	if c.insecureSkipVerify {
+		if tr.TLSClientConfig != nil {
+			tr.TLSClientConfig = tr.TLSClientConfig.Clone()
+		} else {
+			tr.TLSClientConfig = &tls.Config{}
+		}
+		tr.TLSClientConfig.InsecureSkipVerify = true
+	}
+	return tr
 }
 
 // Coins requests /coins path.
 func (c *Client) Coins() ([]string, error) {
+	return c.CoinsContext(context.Background())
+}
+
+// CoinsContext works like Coins, but the request is aborted, when ctx is done.
+func (c *Client) CoinsContext(ctx context.Context) ([]string, error) {
 	var result []string
-	if err := c.get("coins", &result); err != nil {
+	if err := c.get(ctx, "coins", &result); err != nil {
 		return nil, err
 	}
 	return result, nil
 }
 
-// CoinsXCP requests coins/xcp path
-func (c *Client) CoinsXCP() ([]string, error) {
-	var result []string
-	if err := c.get("coins/xcp", &result); err != nil {
+// CoinsPaged returns up to limit coins from /coins path, starting at offset.
+// coincap does not support paging, so the full list is requested and sliced.
+// If offset is past the end of the list, an empty slice is returned.
+// Negative offset or limit result in ErrInvalidPaging.
+func (c *Client) CoinsPaged(offset, limit int) ([]string, error) {
+	if offset < 0 || limit < 0 {
+		return nil, errors.Wrapf(ErrInvalidPaging, "offset %d, limit %d", offset, limit)
+	}
+	coins, err := c.Coins()
+	if err != nil {
 		return nil, err
 	}
-	return result, nil
+	if offset > len(coins) {
+		offset = len(coins)
+	}
+	end := len(coins)
+	if limit < end-offset {
+		end = offset + limit
+	}
+	return coins[offset:end], nil
+}
+
+// CoinsXCP requests coins/xcp path.
+func (c *Client) CoinsXCP() ([]string, error) {
+	return c.CoinsXCPContext(context.Background())
+}
+
+// CoinsXCPContext works like CoinsXCP, but the request is aborted, when ctx is done.
+func (c *Client) CoinsXCPContext(ctx context.Context) ([]string, error) {
+	return c.coinDetail(ctx, "xcp", "")
 }
 
 // CoinsXCPAll requests coins/xcp/all path.
 func (c *Client) CoinsXCPAll() ([]string, error) {
+	return c.CoinsXCPAllContext(context.Background())
+}
+
+// CoinsXCPAllContext works like CoinsXCPAll, but the request is aborted, when ctx is done.
+func (c *Client) CoinsXCPAllContext(ctx context.Context) ([]string, error) {
+	return c.coinDetail(ctx, "xcp", "/all")
+}
+
+// CoinDetail requests coins/{symbol} path, which lists coins related to given platform symbol, like "xcp".
+// The symbol is trimmed and lowercased. If it is not valid according to ValidSymbol, ErrInvalidSymbol is returned.
+func (c *Client) CoinDetail(ctx context.Context, symb string) ([]string, error) {
+	return c.coinDetail(ctx, symb, "")
+}
+
+// CoinDetailAll requests coins/{symbol}/all path. The symbol is handled the same way, as in CoinDetail.
+func (c *Client) CoinDetailAll(ctx context.Context, symb string) ([]string, error) {
+	return c.coinDetail(ctx, symb, "/all")
+}
+
+func (c *Client) coinDetail(ctx context.Context, symb, suffix string) ([]string, error) {
+	symb = strings.ToLower(strings.TrimSpace(symb))
+	if err := ValidSymbol(symb); err != nil {
+		return nil, err
+	}
 	var result []string
-	if err := c.get("coins/xcp/all", &result); err != nil {
+	if err := c.get(ctx, "coins/"+url.PathEscape(symb)+suffix, &result); err != nil {
 		return nil, err
 	}
 	return result, nil
@@ -169,8 +475,13 @@ func (c *Client) CoinsXCPAll() ([]string, error) {
 
 // Map requests /map path.
 func (c *Client) Map() ([]Mapping, error) {
+	return c.MapContext(context.Background())
+}
+
+// MapContext works like Map, but the request is aborted, when ctx is done.
+func (c *Client) MapContext(ctx context.Context) ([]Mapping, error) {
 	var result []Mapping
-	if err := c.get("map", &result); err != nil {
+	if err := c.get(ctx, "map", &result); err != nil {
 		return nil, err
 	}
 	return result, nil
@@ -178,64 +489,433 @@ func (c *Client) Map() ([]Mapping, error) {
 
 // Global requests /global path.
 func (c *Client) Global() (Global, error) {
+	return c.GlobalContext(context.Background())
+}
+
+// GlobalContext works like Global, but the request is aborted, when ctx is done.
+func (c *Client) GlobalContext(ctx context.Context) (Global, error) {
 	var result Global
-	err := c.get("global", &result)
+	err := c.get(ctx, "global", &result)
 	return result, err
 }
 
 // Front requests /front path.
+// coincap usually replies with an array, but a single object is accepted as well, and returned as a slice of one element.
 func (c *Client) Front() ([]Front, error) {
-	var result []Front
-	if err := c.get("front", &result); err != nil {
-		return nil, err
-	}
-	return result, nil
+	return c.front(context.Background(), "front")
 }
 
-// FrontXCP requests front/xcp path.
+// FrontXCP requests front/xcp path. Like in Front, a single object is accepted as well.
 func (c *Client) FrontXCP() ([]Front, error) {
-	var result []Front
-	if err := c.get("front/xcp", &result); err != nil {
+	return c.front(context.Background(), "front/xcp")
+}
+
+func (c *Client) front(ctx context.Context, path string) ([]Front, error) {
+	var result frontList
+	if err := c.get(ctx, path, &result); err != nil {
 		return nil, err
 	}
 	return result, nil
 }
 
 // Page requests /page path for given symbol.
+// The symbol is trimmed, uppercased and validated with ValidSymbol, unless disabled with WithSymbolNormalization.
 func (c *Client) Page(symb string) (*Page, error) {
+	return c.page(context.Background(), symb)
+}
+
+// PriceUSD returns current USD price of given symbol, requesting its page.
+// If the price is empty, ErrCurrencyUnavailable is returned.
+func (c *Client) PriceUSD(ctx context.Context, symb string) (float64, error) {
+	page, err := c.page(ctx, symb)
+	if err != nil {
+		return 0, err
+	}
+	return page.PriceIn("USD")
+}
+
+func (c *Client) page(ctx context.Context, symb string) (*Page, error) {
+	name, err := c.symbolPath(symb)
+	if err != nil {
+		return nil, err
+	}
 	var result Page
-	if err := c.get("page/"+symb, &result); err != nil {
+	if err := c.get(ctx, "page/"+name, &result); err != nil {
 		return nil, err
 	}
 	return &result, nil
 }
 
 // History requests /history path for given symbol.
+// The symbol is trimmed, uppercased and validated with ValidSymbol, unless disabled with WithSymbolNormalization.
 //	interval can be either empty (returns all history on a coin),
-//	or one of the HistoryInterval* consts.
+//	or one of the HistoryInterval* consts, otherwise ErrInvalidInterval is returned.
 func (c *Client) History(symb, interval string) (*History, error) {
+	return c.symbolHistory(context.Background(), symb, interval)
+}
+
+// GlobalHistory requests /history/global path, which contains history of the total market.
+// Price series are usually empty.
+//	interval can be either empty (returns all history),
+//	or one of the HistoryInterval* consts, otherwise ErrInvalidInterval is returned.
+func (c *Client) GlobalHistory(ctx context.Context, interval string) (*History, error) {
+	return c.history(ctx, "global", interval)
+}
+
+// PriceHistory requests /history path for given symbol and returns only its price series.
+// Points are sorted by time, their MarketCap and Volume are NaN.
+// The symbol and the interval are handled the same way, as in History.
+func (c *Client) PriceHistory(ctx context.Context, symb, interval string) ([]HistoryPoint, error) {
+	hist, err := c.symbolHistory(ctx, symb, interval)
+	if err != nil {
+		return nil, err
+	}
+	return (&History{Price: hist.Price}).Points()
+}
+
+// symbolPath returns a normalized and escaped symbol for a request path.
+// Normalized symbols are validated with ValidSymbol, raw ones are only escaped.
+func (c *Client) symbolPath(symb string) (string, error) {
+	symb = c.normalizeSymbol(symb)
+	if !c.rawSymbols {
+		if err := ValidSymbol(symb); err != nil {
+			return "", err
+		}
+	}
+	return url.PathEscape(symb), nil
+}
+
+// symbolHistory requests /history path for given symbol.
+func (c *Client) symbolHistory(ctx context.Context, symb, interval string) (*History, error) {
+	name, err := c.symbolPath(symb)
+	if err != nil {
+		return nil, err
+	}
+	return c.history(ctx, name, interval)
+}
+
+// normalizeSymbol converts a user-provided symbol to the form coincap expects.
+func (c *Client) normalizeSymbol(symb string) string {
+	if c.rawSymbols {
+		return symb
+	}
+	return strings.ToUpper(strings.TrimSpace(symb))
+}
+
+// history requests /history path for given name, which must be already escaped.
+func (c *Client) history(ctx context.Context, name, interval string) (*History, error) {
+	if err := validateInterval(interval); err != nil {
+		return nil, err
+	}
 	var result History
 	if len(interval) > 0 {
 		interval += "/"
 	}
-	if err := c.get("history/"+interval+symb, &result); err != nil {
+	if err := c.get(ctx, "history/"+interval+name, &result); err != nil {
 		return nil, err
 	}
 	return &result, nil
 }
 
-func (c *Client) get(url string, value interface{}) error {
-	resp, err := c.cl.Get(cAPIURL + url)
+// GetRaw sends a GET request to the given API path (e.g. "global" or "page/BTC")
+// and returns the response as is, without checking its status code.
+// It may be used to access response headers, like X-RateLimit-*, or the raw body.
+// The body is decompressed transparently by the http transport.
+// The caller is responsible for closing the response body.
+func (c *Client) GetRaw(ctx context.Context, path string) (resp *http.Response, err error) {
+	var id string
+	defer c.observe(path, &id, time.Now(), &err)
+	id = c.newRequestID()
+	req, err := c.newRequest(ctx, path, id)
+	if err != nil {
+		return nil, withRequestID(err, id)
+	}
+	resp, err = c.cl.Do(req)
+	if err != nil {
+		return nil, withRequestID(errors.Wrap(err, "http request error"), id)
+	}
+	return resp, nil
+}
+
+// Ping checks, that coincap is reachable, requesting /global path.
+// It returns nil, if coincap replied with a 2xx status. The reply is not decoded, and the cache is not used.
+func (c *Client) Ping(ctx context.Context) (err error) {
+	const path = "global"
+	var id string
+	defer c.observe(path, &id, time.Now(), &err)
+	if err := c.acquire(ctx); err != nil {
+		return err
+	}
+	defer c.release()
+	ctx, cancel := c.withRequestTimeout(ctx, path)
+	defer cancel()
+	id = c.newRequestID()
+	req, err := c.newRequest(ctx, path, id)
+	if err != nil {
+		return withRequestID(err, id)
+	}
+	resp, err := c.cl.Do(req)
 	if err != nil {
-		return errors.Wrap(err, "http request error")
+		return withRequestID(withClass(ErrNetwork, errors.Wrap(err, "http request error")), id)
 	}
 	defer resp.Body.Close()
-	if err := json.NewDecoder(resp.Body).Decode(value); err != nil {
-		return errors.Wrap(err, "failed to decode request")
+	// read the body, so that the connection may be reused.
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return withRequestID(newHTTPStatusError(resp), id)
 	}
 	return nil
 }
 
+// Close stops active subscriptions and closes idle http connections.
+// Connections of a transport or a client set with WithTransport or WithHTTPClient are not closed,
+// as they may be shared with other clients.
+// The client must not be used after Close: all requests and subscriptions will fail with ErrClosed.
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closeChan)
+		if c.ownTransport {
+			c.cl.CloseIdleConnections()
+		}
+	})
+	return nil
+}
+
+// checkState returns an error, if the client can't be used.
+func (c *Client) checkState() error {
+	if c.err != nil {
+		return c.err
+	}
+	select {
+	case <-c.closeChan:
+		return ErrClosed
+	default:
+		return nil
+	}
+}
+
+// newRequestID returns an ID for a new request, or an empty string, if request IDs are disabled.
+func (c *Client) newRequestID() string {
+	if c.requestIDFunc == nil {
+		return ""
+	}
+	return c.requestIDFunc()
+}
+
+// newRequest creates a request for given path. If id is not empty, it is sent in X-Request-ID header.
+func (c *Client) newRequest(ctx context.Context, path, id string) (*http.Request, error) {
+	if err := c.checkState(); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, c.apiURL+path, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create request")
+	}
+	req = req.WithContext(ctx)
+	for key, values := range c.headers {
+		req.Header[key] = append([]string(nil), values...)
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	req.Header.Set("Accept", "application/json")
+	if len(id) > 0 {
+		req.Header.Set("X-Request-ID", id)
+	}
+	return req, nil
+}
+
+// observe reports a finished request to the observer, if any.
+func (c *Client) observe(path string, id *string, start time.Time, err *error) {
+	if c.observer == nil && c.requestObserver == nil && c.metrics == nil {
+		return
+	}
+	duration := time.Since(start)
+	if c.observer != nil {
+		c.observer(path, duration, *err)
+	}
+	if c.requestObserver != nil {
+		info := RequestInfo{Path: path, Duration: duration, RequestID: *id, Err: *err}
+		// failed requests may return before the id is known to the caller, but their errors contain it.
+		var idErr *RequestIDError
+		if len(info.RequestID) == 0 && errors.As(info.Err, &idErr) {
+			info.RequestID = idErr.RequestID
+		}
+		c.requestObserver(info)
+	}
+	if c.metrics != nil {
+		c.metrics.RequestDone(path, duration, *err)
+	}
+}
+
+// decodeOptions returns options for decoding replies.
+func (c *Client) decodeOptions() decodeOptions {
+	return decodeOptions{strict: c.strictDecoding, normalizeNumbers: c.normalizeNumbers, decoder: c.decoder}
+}
+
+func (c *Client) get(ctx context.Context, path string, value interface{}) error {
+	_, err := c.getRaw(ctx, path, value)
+	return err
+}
+
+// getRaw works like get, but also returns the reply, which was decoded into value.
+// The reply body may be shared with the cache, and must not be modified.
+func (c *Client) getRaw(ctx context.Context, path string, value interface{}) (res loaded, err error) {
+	defer c.observe(path, &res.id, time.Now(), &err)
+	res, err = c.load(ctx, path)
+	if err != nil {
+		return loaded{}, err
+	}
+	if err := unmarshal(res.data, value, c.decodeOptions()); err != nil {
+		return loaded{}, withRequestID(err, res.id)
+	}
+	return res, nil
+}
+
+// loaded is a reply returned by load.
+type loaded struct {
+	data []byte
+	// id is the ID of the request, or an empty string, if request IDs are disabled, or the reply was cached.
+	id string
+	// fetched is the time, when the reply was received from coincap. For cached replies it is the time of caching.
+	fetched time.Time
+}
+
+// load returns a reply for given path from the cache, or fetches it, if caching is disabled, or the value is stale.
+// Concurrent loads of the same path share a single request, which does not depend on contexts of the callers,
+// see sharedContext. Every caller stops waiting for it, when its own context is done,
+// and the request is canceled, when no callers wait for it.
+// Errors already contain the ID of the request.
+func (c *Client) load(ctx context.Context, path string) (loaded, error) {
+	cacheable := c.cache != nil && c.cache.cacheable(path)
+	if cacheable {
+		if entry, found := c.cache.get(path); found {
+			return loaded{data: entry.data, fetched: entry.fetched}, nil
+		}
+	}
+	shared := c.shared.join(path, func() (context.Context, context.CancelFunc) {
+		return c.sharedContext(path)
+	})
+	defer c.shared.leave(path, shared, &c.group)
+	resChan := c.group.DoChan(path, func() (interface{}, error) {
+		if cacheable {
+			if entry, found := c.cache.get(path); found {
+				return loaded{data: entry.data, fetched: entry.fetched}, nil
+			}
+		}
+		var prev *cacheEntry
+		if cacheable {
+			if entry, found := c.cache.stale(path); found {
+				prev = &entry
+			}
+		}
+		if err := c.acquire(shared.ctx); err != nil {
+			return nil, err
+		}
+		defer c.release()
+		id := c.newRequestID()
+		data, lastModified, err := c.fetchWithRetries(shared.ctx, path, id, prev)
+		if err != nil {
+			return nil, withRequestID(err, id)
+		}
+		fetched := time.Now()
+		if cacheable {
+			fetched = c.cache.set(path, data, lastModified)
+		}
+		return loaded{data: data, id: id, fetched: fetched}, nil
+	})
+	select {
+	case res := <-resChan:
+		if res.Err != nil {
+			return loaded{}, res.Err
+		}
+		return res.Val.(loaded), nil
+	case <-ctx.Done():
+		return loaded{}, withClass(ErrNetwork, errors.Wrap(ctx.Err(), "waiting for a shared request"))
+	}
+}
+
+// sharedContext returns a context for a request to path, which is shared by concurrent loads.
+// It is detached from the callers, so that a caller, which stops waiting, does not fail the others.
+// It is bounded by the request timeout for path, multiplied by the number of attempts, if retries are enabled.
+// If there are no timeouts, the request is not limited.
+func (c *Client) sharedContext(path string) (context.Context, context.CancelFunc) {
+	timeout := c.requestTimeout(path)
+	if timeout == 0 {
+		timeout = c.cl.Timeout
+	}
+	if timeout == 0 {
+		return context.WithCancel(context.Background())
+	}
+	if c.retryBudget != nil {
+		timeout *= maxRetries + 1
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// acquire waits for a free slot, if the number of in-flight requests is limited with WithMaxConcurrency.
+func (c *Client) acquire(ctx context.Context) error {
+	if c.inFlight == nil {
+		return nil
+	}
+	select {
+	case c.inFlight <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return withClass(ErrNetwork, errors.Wrap(ctx.Err(), "waiting for a request slot"))
+	}
+}
+
+// release frees a slot taken by acquire.
+func (c *Client) release() {
+	if c.inFlight != nil {
+		<-c.inFlight
+	}
+}
+
+// fetch requests given path and returns the reply as raw json and its Last-Modified header.
+// If prev is not nil, it is revalidated with If-Modified-Since header, and its data is returned,
+// if coincap replies with 304 Not Modified.
+func (c *Client) fetch(ctx context.Context, path, id string, prev *cacheEntry) ([]byte, string, error) {
+	ctx, cancel := c.withRequestTimeout(ctx, path)
+	defer cancel()
+	req, err := c.newRequest(ctx, path, id)
+	if err != nil {
+		return nil, "", err
+	}
+	// as we set Accept-Encoding ourselves, the transport won't decompress the body.
+	req.Header.Set("Accept-Encoding", "gzip")
+	if prev != nil {
+		req.Header.Set("If-Modified-Since", prev.lastModified)
+	}
+	resp, err := c.cl.Do(req)
+	if err != nil {
+		return nil, "", withClass(ErrNetwork, errors.Wrap(err, "http request error"))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && prev != nil {
+		return prev.data, prev.lastModified, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, "", newHTTPStatusError(resp)
+	}
+	var body io.Reader = resp.Body
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, "", withClass(ErrDecode, errors.Wrap(err, "failed to create gzip reader"))
+		}
+		defer gz.Close()
+		body = gz
+	}
+	if err := checkContentType(resp.Header.Get("Content-Type"), body); err != nil {
+		return nil, "", err
+	}
+	data, err := readJSON(body)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, resp.Header.Get("Last-Modified"), nil
+}
+
 // SubscribeTrades subscribes for websocket messages on 'trades' channel.
 // All incoming messages are sent to 'dataChan'.
 // If there are errors during subscription, it returns an error immediately.
@@ -246,21 +926,449 @@ func (c *Client) get(url string, value interface{}) error {
 //		close it or send 'true' to stop subscribtion.
 //		send 'false' to reconnect. May be useful, if updates stalled.
 func (c *Client) SubscribeTrades(dataChan chan<- *Trade, stopChan <-chan bool) error {
+	return c.subscribeTrades(c.newSubscription(), dataChan, stopChan, nil)
+}
+
+// SubscribeTradesFor works like SubscribeTrades, but the subscription is stopped after d, or when ctx is done,
+// whichever happens first. It returns nil, if stopped after d, and ctx.Err(), if ctx is done earlier.
+func (c *Client) SubscribeTradesFor(ctx context.Context, d time.Duration, dataChan chan<- *Trade) error {
+	stopChan, doneChan := make(chan bool), make(chan struct{})
+	// canceledChan receives true, if the subscription was stopped, because ctx is done.
+	canceledChan := make(chan bool, 1)
+	go func() {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			canceledChan <- false
+		case <-ctx.Done():
+			canceledChan <- true
+		case <-doneChan:
+			canceledChan <- false
+			return
+		}
+		close(stopChan)
+	}()
+	err := c.SubscribeTrades(dataChan, stopChan)
+	close(doneChan)
+	if canceled := <-canceledChan; canceled && err == nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// SubscribeTradesFiltered works like SubscribeTrades, but sends to 'dataChan' only the trades,
+// for which filter returns true.
+func (c *Client) SubscribeTradesFiltered(dataChan chan<- *Trade, stopChan <-chan bool, filter func(*Trade) bool) error {
+	return c.subscribeTrades(c.newSubscription(), dataChan, stopChan, filter)
+}
+
+// SubscribeTradesWithErrors works like SubscribeTrades, but websocket disconnects and errors
+// do not terminate the subscription. Instead, they are sent to 'errChan', and the client reconnects.
+// Messages, which can't be decoded (ErrDecode), and panics caused by messages, e.g. in a filter,
+// are sent to 'errChan' as well, but the connection is kept. Subscriptions without errChan just log them.
+// Frames, which are not valid json at all, are dropped by the socket.io library silently.
+// Errors are sent without blocking, so they are dropped, if errChan is not ready.
+// It returns only if the initial connection can't be established, or on stop signal.
+// Failed dials of reconnects are sent to 'errChan' and retried, see WithBackoff.
+func (c *Client) SubscribeTradesWithErrors(dataChan chan<- *Trade, stopChan <-chan bool, errChan chan<- error) error {
+	sub := c.newSubscription()
+	sub.errChan = errChan
+	return c.subscribeTrades(sub, dataChan, stopChan, nil)
+}
+
+// Control is a command for a subscription, see SubscribeTradesControl.
+type Control int
+
+const (
+	// ControlStop stops the subscription. Closing the control channel stops it as well.
+	ControlStop Control = iota
+	// ControlReconnect makes the subscription reconnect. May be useful, if updates stalled.
+	ControlReconnect
+)
+
+// SubscribeTradesControl works like SubscribeTrades, but the subscription is controlled with typed commands
+// instead of booleans. Unknown commands are ignored.
+func (c *Client) SubscribeTradesControl(dataChan chan<- *Trade, ctrlChan <-chan Control) error {
+	sub := c.newSubscription()
+	return c.subscribeTrades(sub, dataChan, controlToStop(ctrlChan, sub.quit), nil)
+}
+
+// controlToStop translates commands from ctrlChan to the stopChan protocol, until quit is closed.
+func controlToStop(ctrlChan <-chan Control, quit <-chan struct{}) <-chan bool {
+	stopChan := make(chan bool)
+	go func() {
+		for {
+			var ctrl Control
+			var ok bool
+			select {
+			case ctrl, ok = <-ctrlChan:
+			case <-quit:
+				return
+			}
+			if !ok {
+				close(stopChan)
+				return
+			}
+			if ctrl != ControlStop && ctrl != ControlReconnect {
+				continue
+			}
+			select {
+			case stopChan <- ctrl == ControlStop:
+			case <-quit:
+				return
+			}
+		}
+	}()
+	return stopChan
+}
+
+// subscribeTrades subscribes on 'trades' channel. If filter is not nil, only matching trades are sent to dataChan.
+func (c *Client) subscribeTrades(sub *subscription, dataChan chan<- *Trade, stopChan <-chan bool, filter func(*Trade) bool) error {
 	type wrapper struct {
 		Message TradeMessage
-		Trade   struct {
-			Data TradeData
-		}
+		// Trade is decoded separately, as coincap may omit it, or send it in another form.
+		Trade json.RawMessage
+	}
+	var dd *dedup
+	if c.dedupSize > 0 {
+		dd = newDedup(c.dedupSize)
 	}
-	return c.subscribe("trades", func(ch *gosio.Channel, tm wrapper) {
-		dataChan <- &Trade{Msg: tm.Message, Data: tm.Trade.Data}
+	decoder := c.decoder
+	if decoder == nil {
+		decoder = stdDecoder{}
+	}
+	return c.subscribe(sub, "trades", func(ch *gosio.Channel, raw json.RawMessage) {
+		sub.begin()
+		defer sub.end()
+		defer c.recoverHandler(sub, "trades")
+		sub.touch()
+		if c.metrics != nil {
+			c.metrics.MessageReceived("trades")
+		}
+		var tm wrapper
+		if err := decoder.Unmarshal(raw, &tm); err != nil {
+			err = withClass(ErrDecode, errors.Wrap(err, "trades: failed to decode message"))
+			c.logger.Printf("coincap: %v", err)
+			sub.report(err)
+			return
+		}
+		data, hasData, err := decodeTradeData(tm.Trade, decoder)
+		if err != nil {
+			err = withClass(ErrDecode, errors.Wrap(err, "trades: failed to decode trade data"))
+			c.logger.Printf("coincap: %v", err)
+			sub.report(err)
+			return
+		}
+		trade := &Trade{Msg: tm.Message, Data: data, HasData: hasData}
+		if c.maxSkew > 0 {
+			if skew := trade.Skew(); skew > c.maxSkew || skew < -c.maxSkew {
+				c.logger.Printf("coincap: trades: trade %s on %s has time skew %v", trade.Data.Raw.ID, trade.Msg.MarketID, skew)
+			}
+		}
+		if dd != nil && dd.seen(trade) {
+			atomic.AddUint64(&c.stats.duplicates, 1)
+			return
+		}
+		if filter != nil && !filter(trade) {
+			return
+		}
+		if c.dropPolicy == DropPolicyDrop {
+			select {
+			case dataChan <- trade:
+			default:
+				atomic.AddUint64(&c.stats.dropped, 1)
+			}
+			return
+		}
+		var timeout <-chan time.Time
+		if c.sendTimeout > 0 {
+			timer := time.NewTimer(c.sendTimeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case dataChan <- trade:
+		case <-sub.quit:
+		case <-timeout:
+			c.sendTimedOut(sub, "trades")
+		}
 	}, stopChan)
 }
 
-func (c *Client) subscribe(method string, handler interface{}, stopChan <-chan bool) error {
+// dial connects to the websocket server. If the connection isn't established within dialTimeout,
+// it returns an error, and the pending connection is closed as soon as the dial completes.
+func (c *Client) dial() (*gosio.Client, error) {
+	type result struct {
+		client *gosio.Client
+		err    error
+	}
+	resultChan := make(chan result, 1)
+	go func() {
+		tr := c.wsTransport
+		if tr == nil {
+			tr = transport.GetDefaultWebsocketTransport()
+		}
+		client, err := gosio.Dial(c.wsURL, tr)
+		resultChan <- result{client: client, err: err}
+	}()
+	var timeoutChan <-chan time.Time
+	if c.dialTimeout > 0 {
+		timer := time.NewTimer(c.dialTimeout)
+		defer timer.Stop()
+		timeoutChan = timer.C
+	}
+	select {
+	case res := <-resultChan:
+		return res.client, res.err
+	case <-timeoutChan:
+		go func() {
+			if res := <-resultChan; res.client != nil {
+				res.client.Close()
+			}
+		}()
+		return nil, errors.Errorf("no connection in %v", c.dialTimeout)
+	}
+}
+
+// DropPolicy defines, what subscriptions do with a message, if the data channel is not ready to receive it.
+type DropPolicy int
+
+const (
+	// DropPolicyBlock makes subscriptions wait until the message is received.
+	// No data is lost, but a slow consumer receives stale data, and pending messages pile up in memory.
+	DropPolicyBlock DropPolicy = iota
+	// DropPolicyDrop makes subscriptions drop the message, if the channel is not ready.
+	// The consumer always receives fresh data, but some messages are lost. See DroppedMessages.
+	DropPolicyDrop
+	// DropPolicyFail makes subscriptions fail with ErrSendTimeout, if the message is not received
+	// within the timeout set with WithSendTimeout. Without the timeout it works like DropPolicyBlock.
+	DropPolicyFail
+)
+
+// ErrSendTimeout is returned by subscriptions with DropPolicyFail, if the consumer does not receive a message in time.
+var ErrSendTimeout = errors.New("send timeout")
+
+// sendTimedOut handles a message, which was not received within the send timeout, according to the drop policy.
+func (c *Client) sendTimedOut(sub *subscription, method string) {
+	if c.dropPolicy == DropPolicyFail {
+		sub.fail(errors.Wrap(ErrSendTimeout, method))
+		return
+	}
+	atomic.AddUint64(&c.stats.dropped, 1)
+}
+
+// DroppedMessages returns the number of messages dropped by all the subscriptions of the client.
+func (c *Client) DroppedMessages() uint64 {
+	return atomic.LoadUint64(&c.stats.dropped)
+}
+
+// SubscriptionStats contains counters of all the subscriptions of a client.
+type SubscriptionStats struct {
+	// Messages is the number of received messages.
+	Messages uint64
+	// Dropped is the number of messages dropped according to DropPolicyDrop, or after the send timeout.
+	Dropped uint64
+	// Duplicates is the number of trades suppressed by WithTradeDedup.
+	Duplicates uint64
+	// Reconnects is the number of reconnects, either automatic or requested via stopChan.
+	Reconnects uint64
+	// Connections is the number of currently active websocket connections.
+	Connections int64
+	// LastMessage is the time of the last received message, or zero time, if there were no messages.
+	LastMessage time.Time
+}
+
+// subscriptionCounters are updated atomically. It is allocated separately to guarantee 64-bit alignment.
+type subscriptionCounters struct {
+	messages    uint64
+	dropped     uint64
+	duplicates  uint64
+	reconnects  uint64
+	connections int64
+	// lastMessage is unix time in nanoseconds.
+	lastMessage int64
+}
+
+// SubscriptionStats returns a snapshot of subscription counters. It is safe to call it concurrently with subscriptions.
+func (c *Client) SubscriptionStats() SubscriptionStats {
+	stats := SubscriptionStats{
+		Messages:    atomic.LoadUint64(&c.stats.messages),
+		Dropped:     atomic.LoadUint64(&c.stats.dropped),
+		Duplicates:  atomic.LoadUint64(&c.stats.duplicates),
+		Reconnects:  atomic.LoadUint64(&c.stats.reconnects),
+		Connections: atomic.LoadInt64(&c.stats.connections),
+	}
+	if last := atomic.LoadInt64(&c.stats.lastMessage); last != 0 {
+		stats.LastMessage = time.Unix(0, last)
+	}
+	return stats
+}
+
+// subscription holds the state of a websocket subscription, shared between its message handler and the subscribe loop.
+type subscription struct {
+	stats *subscriptionCounters
+	// activity receives a value, when a message arrives.
+	activity chan struct{}
+	// errChan, if not nil, receives non-fatal errors.
+	errChan chan<- error
+	// quit is closed, when the subscription returns, to release handlers blocked on sending data.
+	quit chan struct{}
+	// failed receives an error, which terminates the subscription regardless of errChan.
+	failed chan error
+
+	mut sync.Mutex
+	// pending is the number of running message handlers.
+	pending int
+	// idle, if not nil, is closed, when pending becomes 0.
+	idle chan struct{}
+}
+
+func (c *Client) newSubscription() *subscription {
+	return &subscription{stats: c.stats, activity: make(chan struct{}, 1), quit: make(chan struct{}), failed: make(chan error, 1)}
+}
+
+// touch must be called by message handlers on every incoming message.
+func (s *subscription) touch() {
+	atomic.AddUint64(&s.stats.messages, 1)
+	atomic.StoreInt64(&s.stats.lastMessage, time.Now().UnixNano())
+	select {
+	case s.activity <- struct{}{}:
+	default:
+	}
+}
+
+// begin must be called by message handlers before processing a message.
+func (s *subscription) begin() {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.pending++
+}
+
+// end must be called by message handlers after processing a message.
+func (s *subscription) end() {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.pending--
+	if s.pending == 0 && s.idle != nil {
+		close(s.idle)
+		s.idle = nil
+	}
+}
+
+// drain waits until running message handlers deliver their messages, but not longer than timeout.
+func (s *subscription) drain(timeout time.Duration) {
+	s.mut.Lock()
+	if s.pending == 0 {
+		s.mut.Unlock()
+		return
+	}
+	if s.idle == nil {
+		s.idle = make(chan struct{})
+	}
+	idle := s.idle
+	s.mut.Unlock()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-idle:
+	case <-timer.C:
+	}
+}
+
+// recoverHandler must be deferred by message handlers. It recovers a panic caused by a message,
+// logs it, and reports it to errChan, so that a bad message does not kill the whole subscription.
+func (c *Client) recoverHandler(sub *subscription, method string) {
+	if r := recover(); r != nil {
+		err := errors.Errorf("%s: message handler panic: %v", method, r)
+		c.logger.Printf("coincap: %v", err)
+		sub.report(err)
+	}
+}
+
+// fail terminates the subscription with err, unless it is already being terminated.
+func (s *subscription) fail(err error) {
+	select {
+	case s.failed <- err:
+	default:
+	}
+}
+
+// report sends err to errChan without blocking.
+// It returns false, if errors are not reported, and must be treated as fatal.
+func (s *subscription) report(err error) bool {
+	if s.errChan == nil {
+		return false
+	}
+	select {
+	case s.errChan <- err:
+	default:
+	}
+	return true
+}
+
+// waitReconnect waits for delay before an automatic reconnect. A reconnect request from stopChan interrupts the wait.
+// It returns false, and sets stopped, if the subscription was stopped during the wait.
+func (c *Client) waitReconnect(delay time.Duration, stopChan <-chan bool, stopped *bool) bool {
+	if delay <= 0 {
+		return true
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case val, ok := <-stopChan:
+		*stopped = !ok || val
+		return !*stopped
+	case <-c.closeChan:
+		return false
+	}
+}
+
+// runReconnectHook calls the hook set with WithReconnectHook, if any, and waits for it to return.
+// Stop signals and the client close interrupt the wait, canceling the context passed to the hook.
+// It returns false, if the subscription must not reconnect, with the hook error, if it failed.
+func (c *Client) runReconnectHook(stopChan <-chan bool, stopped *bool) (bool, error) {
+	if c.reconnectHook == nil {
+		return true, nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	resultChan := make(chan error, 1)
+	go func() {
+		resultChan <- c.reconnectHook(ctx)
+	}()
+	for {
+		select {
+		case err := <-resultChan:
+			if err != nil {
+				return false, errors.Wrap(err, "reconnect hook failed")
+			}
+			return true, nil
+		case val, ok := <-stopChan:
+			if !ok || val {
+				*stopped = true
+				return false, nil
+			}
+			// a reconnect is about to happen anyway.
+		case <-c.closeChan:
+			return false, nil
+		}
+	}
+}
+
+func (c *Client) subscribe(sub *subscription, method string, handler interface{}, stopChan <-chan bool) error {
+	defer close(sub.quit)
+	states := c.newConnStateNotifier()
+	defer states.stop()
+	if err := c.checkState(); err != nil {
+		return err
+	}
 	makeClient := func(errCh chan error) (*gosio.Client, error) {
-		client, err := gosio.Dial(gosio.GetUrl(cWsURL, 443, true), transport.GetDefaultWebsocketTransport())
+		client, err := c.dial()
 		if err != nil {
+			c.logger.Printf("coincap: %s: dial error: %v", method, err)
 			return nil, errors.Wrap(err, "coincap: ws dial error")
 		}
 		defer func() {
@@ -269,12 +1377,14 @@ func (c *Client) subscribe(method string, handler interface{}, stopChan <-chan b
 			}
 		}()
 		err = client.On(gosio.OnDisconnection, func(ch *gosio.Channel) {
+			c.logger.Printf("coincap: %s: disconnected on channel %s", method, ch.Id())
 			errCh <- errors.Errorf("websocket disconnected on channel %s", ch.Id())
 		})
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to setup disconnect handler")
 		}
 		err = client.On(gosio.OnError, func(ch *gosio.Channel) {
+			c.logger.Printf("coincap: %s: error on channel %s", method, ch.Id())
 			errCh <- errors.Errorf("websocket error on channel %s", ch.Id())
 		})
 		if err != nil {
@@ -283,25 +1393,106 @@ func (c *Client) subscribe(method string, handler interface{}, stopChan <-chan b
 		if err = client.On(method, handler); err != nil {
 			return nil, errors.Wrap(err, "failed to setup message handler")
 		}
+		c.logger.Printf("coincap: %s: connected", method)
 		return client, nil
 	}
+	// stopped is set, if the subscription was stopped via stopChan, requested - if a reconnect was requested.
+	var stopped, requested bool
+	// connected is set after the first successful dial, dialFailed - if the last dial failed.
+	// Dial errors are fatal until the subscription is connected, failed reconnects may be retried.
+	var connected, dialFailed bool
+	// attempt is the number of automatic reconnects since the last received message.
+	var attempt int
 	doConnect := func() (bool, error) {
 		errCh := make(chan error, 2)
 		client, err := makeClient(errCh)
 		if err != nil {
+			dialFailed = true
 			return false, err
 		}
+		connected = true
 		defer client.Close()
-		select {
-		case err := <-errCh:
-			return false, err
-		case val, ok := <-stopChan:
-			return ok && !val, nil
+		states.notify(ConnStateConnected)
+		defer states.notify(ConnStateDisconnected)
+		atomic.AddInt64(&c.stats.connections, 1)
+		defer atomic.AddInt64(&c.stats.connections, -1)
+		var stallTimer *time.Timer
+		var stallChan <-chan time.Time
+		if c.stallTimeout > 0 {
+			stallTimer = time.NewTimer(c.stallTimeout)
+			defer stallTimer.Stop()
+			stallChan = stallTimer.C
+		}
+		for {
+			select {
+			case err := <-errCh:
+				return sub.report(err), err
+			case err := <-sub.failed:
+				return false, err
+			case val, ok := <-stopChan:
+				stopped = !ok || val
+				requested = !stopped
+				return !stopped, nil
+			case <-c.closeChan:
+				return false, nil
+			case <-sub.activity:
+				if attempt > 0 && c.backoff != nil {
+					c.backoff.Reset()
+				}
+				attempt = 0
+				if stallTimer != nil {
+					if !stallTimer.Stop() {
+						select {
+						case <-stallTimer.C:
+						default:
+						}
+					}
+					stallTimer.Reset(c.stallTimeout)
+				}
+			case <-stallChan:
+				c.logger.Printf("coincap: %s: no messages for %v", method, c.stallTimeout)
+				sub.report(errors.Errorf("no messages for %v", c.stallTimeout))
+				return true, nil
+			}
 		}
 	}
+	states.notify(ConnStateConnecting)
 	for {
-		if goon, err := doConnect(); !goon {
+		requested, dialFailed = false, false
+		goon, err := doConnect()
+		if dialFailed && connected {
+			// like disconnects, failed reconnects are retried only if there is an error channel.
+			goon = sub.report(err)
+		}
+		backoff := c.backoff
+		if backoff == nil && dialFailed {
+			backoff = defaultReconnectBackoff
+		}
+		if goon && !requested && backoff != nil {
+			attempt++
+			if goon = c.waitReconnect(backoff.NextDelay(attempt), stopChan, &stopped); !goon {
+				err = nil
+			}
+		}
+		if goon {
+			goon, err = c.runReconnectHook(stopChan, &stopped)
+		}
+		if !goon {
+			if err != nil {
+				c.logger.Printf("coincap: %s: subscription terminated: %v", method, err)
+			} else {
+				c.logger.Printf("coincap: %s: subscription stopped", method)
+			}
+			if stopped && c.drainTimeout > 0 {
+				sub.drain(c.drainTimeout)
+			}
 			return err
 		}
+		c.logger.Printf("coincap: %s: reconnecting", method)
+		atomic.AddUint64(&c.stats.reconnects, 1)
+		if c.metrics != nil {
+			c.metrics.Reconnected()
+		}
+		states.notify(ConnStateReconnecting)
 	}
 }
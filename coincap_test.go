@@ -3,8 +3,25 @@
 package coincap
 
 import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	gosio "github.com/graarh/golang-socketio"
+	"github.com/graarh/golang-socketio/transport"
+	"github.com/pkg/errors"
 )
 
 func TestGlobal(t *testing.T) {
@@ -99,3 +116,1315 @@ func TestSubscribeTrades(t *testing.T) {
 	case <-doneChan:
 	}
 }
+
+// newTestClient returns a client, which sends API requests to a test server with given handler.
+// The server is closed on test cleanup.
+func newTestClient(t *testing.T, handler http.HandlerFunc, opts ...Option) *Client {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	client := New(opts...)
+	client.apiURL = srv.URL + "/"
+	return client
+}
+
+// newTestWsServer starts a socket.io server and makes client subscribe to it.
+// onConnect is called for every new connection. The server is closed on test cleanup.
+func newTestWsServer(t *testing.T, client *Client, onConnect func(ch *gosio.Channel)) *gosio.Server {
+	server := gosio.NewServer(transport.GetDefaultWebsocketTransport())
+	if err := server.On(gosio.OnConnection, onConnect); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+	addr := srv.Listener.Addr().(*net.TCPAddr)
+	client.wsURL = gosio.GetUrl(addr.IP.String(), addr.Port, false)
+	return server
+}
+
+// testLogger collects log lines. It is safe for concurrent use.
+type testLogger struct {
+	mut   sync.Mutex
+	lines []string
+}
+
+func (l *testLogger) Printf(format string, v ...interface{}) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func (l *testLogger) contains(substr string) bool {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	for _, line := range l.lines {
+		if strings.Contains(line, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSubscribeLogging(t *testing.T) {
+	logger := &testLogger{}
+	client := New(WithLogger(logger))
+	var mut sync.Mutex
+	var connections int
+	newTestWsServer(t, client, func(ch *gosio.Channel) {
+		mut.Lock()
+		defer mut.Unlock()
+		connections++
+		if connections > 1 { // drop the connection after the reconnect.
+			go func() {
+				time.Sleep(time.Millisecond * 100)
+				ch.Close()
+			}()
+		}
+	})
+	stopChan := make(chan bool)
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		stopChan <- false
+	}()
+	if err := client.SubscribeTrades(make(chan *Trade), stopChan); err == nil {
+		t.Error("expected disconnect error")
+	}
+	for _, line := range []string{"connected", "reconnecting", "disconnected", "terminated"} {
+		if !logger.contains(line) {
+			t.Errorf("%q was not logged: %v", line, logger.lines)
+		}
+	}
+}
+
+const testTradeMessage = `{"message":{"coin":"BTC","exchange_id":"bitfinex","market_id":"BTC_USD","msg":{"short":"BTC","price":4000}},` +
+	`"trade":{"data":{"exchange_id":"bitfinex","market_id":"BTC_USD","price":4000,"raw":{"ID":"1"}}}}`
+
+// tradeMessage returns a 'trades' websocket message for given exchange and market.
+func tradeMessage(exchange, market, id string, price float64) json.RawMessage {
+	return json.RawMessage(fmt.Sprintf(`{"message":{"coin":"BTC","exchange_id":%[1]q,"market_id":%[2]q,"msg":{"short":"BTC","price":%[4]v}},`+
+		`"trade":{"data":{"exchange_id":%[1]q,"market_id":%[2]q,"price":%[4]v,"raw":{"ID":%[3]q}}}}`, exchange, market, id, price))
+}
+
+// emitMessages sends messages to ch after a small delay, so that the client has time to setup its handlers.
+func emitMessages(ch *gosio.Channel, method string, messages ...json.RawMessage) {
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		for _, msg := range messages {
+			ch.Emit(method, msg)
+		}
+	}()
+}
+
+// emitTrades sends n test trade messages to ch after a small delay, so that the client has time to setup its handlers.
+func emitTrades(ch *gosio.Channel, n int) {
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		for i := 0; i < n; i++ {
+			ch.Emit("trades", json.RawMessage(testTradeMessage))
+		}
+	}()
+}
+
+func TestSubscribeStallTimeout(t *testing.T) {
+	client := New(WithStallTimeout(time.Millisecond * 200))
+	var connections int32
+	newTestWsServer(t, client, func(ch *gosio.Channel) {
+		atomic.AddInt32(&connections, 1)
+		emitTrades(ch, 1) // send a message and go silent.
+	})
+	tradeChan, stopChan := make(chan *Trade), make(chan bool)
+	doneChan := make(chan error)
+	go func() {
+		doneChan <- client.SubscribeTrades(tradeChan, stopChan)
+	}()
+	for received := 0; received < 3; received++ {
+		select {
+		case <-tradeChan:
+		case <-time.After(time.Second * 2):
+			t.Fatalf("only %d trades received", received)
+		}
+	}
+	close(stopChan)
+	if err := <-doneChan; err != nil {
+		t.Error(err)
+	}
+	if n := atomic.LoadInt32(&connections); n < 3 {
+		t.Errorf("expected at least 3 connections, got %d", n)
+	}
+}
+
+func TestSubscribeDialTimeout(t *testing.T) {
+	// a server, which accepts connections, but never replies.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	client := New(WithDialTimeout(time.Millisecond * 100))
+	addr := ln.Addr().(*net.TCPAddr)
+	client.wsURL = gosio.GetUrl(addr.IP.String(), addr.Port, false)
+	start := time.Now()
+	if err := client.SubscribeTrades(make(chan *Trade), make(chan bool)); err == nil {
+		t.Error("expected dial timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("dial did not time out, took %v", elapsed)
+	}
+}
+
+func TestSubscribeReconnectDialTimeout(t *testing.T) {
+	client := New(WithDialTimeout(time.Millisecond*100), WithBackoff(ConstantBackoff{Delay: time.Millisecond * 10}))
+	// the first reconnect hangs for longer than the dial timeout.
+	tr := &flakyTransport{WebsocketTransport: transport.GetDefaultWebsocketTransport(), failing: map[int32]bool{2: true}, delay: time.Second}
+	client.wsTransport = tr
+	newTestWsServer(t, client, func(ch *gosio.Channel) {
+		emitTrades(ch, 1)
+	})
+	tradeChan, stopChan, errChan, doneChan := make(chan *Trade), make(chan bool), make(chan error, 10), make(chan error)
+	go func() {
+		doneChan <- client.SubscribeTradesWithErrors(tradeChan, stopChan, errChan)
+	}()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-tradeChan:
+		case <-time.After(time.Second * 2):
+			t.Fatalf("no trade on connection %d", i+1)
+		}
+		if i == 0 {
+			stopChan <- false
+		}
+	}
+	close(stopChan)
+	if err := <-doneChan; err != nil {
+		t.Error(err)
+	}
+	select {
+	case err := <-errChan:
+		if !strings.Contains(err.Error(), "no connection in") {
+			t.Errorf("expected dial timeout error, got %v", err)
+		}
+	default:
+		t.Error("dial timeout was not reported")
+	}
+	if n := atomic.LoadInt32(&tr.connects); n != 3 {
+		t.Errorf("expected 3 connects, got %d", n)
+	}
+}
+
+func TestSubscribeTradesReconnectDialTimeout(t *testing.T) {
+	client := New(WithDialTimeout(time.Millisecond * 100))
+	client.wsTransport = &flakyTransport{WebsocketTransport: transport.GetDefaultWebsocketTransport(), failing: map[int32]bool{2: true}, delay: time.Second}
+	newTestWsServer(t, client, func(ch *gosio.Channel) {
+		emitTrades(ch, 1)
+	})
+	tradeChan, stopChan, doneChan := make(chan *Trade), make(chan bool), make(chan error)
+	go func() {
+		doneChan <- client.SubscribeTrades(tradeChan, stopChan)
+	}()
+	select {
+	case <-tradeChan:
+	case <-time.After(time.Second * 2):
+		t.Fatal("no trade")
+	}
+	stopChan <- false
+	select {
+	case err := <-doneChan:
+		if err == nil || !strings.Contains(err.Error(), "no connection in") {
+			t.Errorf("expected dial timeout error, got %v", err)
+		}
+	case <-time.After(time.Second * 2):
+		t.Fatal("subscription did not return the dial timeout error")
+	}
+}
+
+// serveFile returns a handler, which replies with the contents of given testdata file.
+func serveFile(t *testing.T, name string) http.HandlerFunc {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}
+}
+
+func TestSubscribeTradesWithErrors(t *testing.T) {
+	client := New()
+	var connections int32
+	newTestWsServer(t, client, func(ch *gosio.Channel) {
+		if atomic.AddInt32(&connections, 1) == 1 {
+			go func() {
+				time.Sleep(time.Millisecond * 100)
+				ch.Close()
+			}()
+			return
+		}
+		emitTrades(ch, 1)
+	})
+	tradeChan, stopChan, errChan := make(chan *Trade), make(chan bool), make(chan error, 10)
+	doneChan := make(chan error)
+	go func() {
+		doneChan <- client.SubscribeTradesWithErrors(tradeChan, stopChan, errChan)
+	}()
+	select {
+	case <-tradeChan:
+	case <-time.After(time.Second * 2):
+		t.Fatal("no trades after reconnect")
+	}
+	close(stopChan)
+	if err := <-doneChan; err != nil {
+		t.Error(err)
+	}
+	select {
+	case err := <-errChan:
+		if !strings.Contains(err.Error(), "disconnected") {
+			t.Errorf("unexpected error %v", err)
+		}
+	default:
+		t.Error("disconnect was not reported")
+	}
+}
+
+func TestSubscribeTradesFiltered(t *testing.T) {
+	client := New()
+	newTestWsServer(t, client, func(ch *gosio.Channel) {
+		emitMessages(ch, "trades",
+			tradeMessage("bitfinex", "BTC_USD", "1", 4000),
+			tradeMessage("poloniex", "BTC_USDT", "2", 4001),
+			tradeMessage("bitfinex", "BTC_USD", "3", 4002),
+			tradeMessage("gdax", "BTC_USD", "4", 4003),
+			tradeMessage("bitfinex", "BTC_USD", "5", 4004),
+		)
+	})
+	tradeChan, stopChan := make(chan *Trade), make(chan bool)
+	doneChan := make(chan error)
+	go func() {
+		doneChan <- client.SubscribeTradesFiltered(tradeChan, stopChan, func(trade *Trade) bool {
+			return trade.Msg.ExchangeID == "bitfinex"
+		})
+	}()
+	var received int
+	for timeout := time.After(time.Millisecond * 300); timeout != nil; {
+		select {
+		case trade := <-tradeChan:
+			received++
+			if trade.Msg.ExchangeID != "bitfinex" || trade.Data.ExchangeID != "bitfinex" {
+				t.Errorf("unexpected trade from %s", trade.Msg.ExchangeID)
+			}
+		case <-timeout:
+			timeout = nil
+		}
+	}
+	close(stopChan)
+	if err := <-doneChan; err != nil {
+		t.Error(err)
+	}
+	if received != 3 {
+		t.Errorf("expected 3 trades, got %d", received)
+	}
+}
+
+func TestSubscribeDropPolicy(t *testing.T) {
+	client := New(WithDropPolicy(DropPolicyDrop))
+	server := newTestWsServer(t, client, func(ch *gosio.Channel) {
+		emitTrades(ch, 10)
+	})
+	tradeChan, stopChan := make(chan *Trade, 2), make(chan bool)
+	doneChan := make(chan error)
+	go func() {
+		doneChan <- client.SubscribeTrades(tradeChan, stopChan)
+	}()
+	time.Sleep(time.Millisecond * 300) // a slow consumer.
+	if n := client.DroppedMessages(); n != 8 {
+		t.Errorf("expected 8 dropped messages, got %d", n)
+	}
+	<-tradeChan
+	<-tradeChan
+	server.BroadcastToAll("trades", json.RawMessage(testTradeMessage))
+	select {
+	case <-tradeChan:
+	case <-time.After(time.Second):
+		t.Error("subscription is not alive")
+	}
+	close(stopChan)
+	if err := <-doneChan; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSubscribeSendTimeout(t *testing.T) {
+	client := New(WithSendTimeout(time.Millisecond * 20))
+	server := newTestWsServer(t, client, func(ch *gosio.Channel) {
+		emitTrades(ch, 5)
+	})
+	tradeChan, stopChan := make(chan *Trade), make(chan bool)
+	doneChan := make(chan error)
+	go func() {
+		doneChan <- client.SubscribeTrades(tradeChan, stopChan)
+	}()
+	time.Sleep(time.Millisecond * 300) // a stalled consumer.
+	if n := client.SubscriptionStats().Dropped; n != 5 {
+		t.Errorf("expected 5 dropped messages, got %d", n)
+	}
+	server.BroadcastToAll("trades", json.RawMessage(testTradeMessage))
+	select {
+	case <-tradeChan:
+	case <-time.After(time.Second):
+		t.Error("subscription is not alive")
+	}
+	close(stopChan)
+	if err := <-doneChan; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSubscribeSendTimeoutFail(t *testing.T) {
+	client := New(WithSendTimeout(time.Millisecond*50), WithDropPolicy(DropPolicyFail))
+	newTestWsServer(t, client, func(ch *gosio.Channel) {
+		emitTrades(ch, 1)
+	})
+	doneChan := make(chan error)
+	go func() {
+		// errors are reported to errChan, but the send timeout still terminates the subscription.
+		doneChan <- client.SubscribeTradesWithErrors(make(chan *Trade), make(chan bool), make(chan error, 1))
+	}()
+	select {
+	case err := <-doneChan:
+		if !errors.Is(err, ErrSendTimeout) {
+			t.Errorf("expected send timeout error, got %v", err)
+		}
+	case <-time.After(time.Second * 2):
+		t.Error("subscription did not fail")
+	}
+	if n := client.SubscriptionStats().Dropped; n != 0 {
+		t.Errorf("expected no dropped messages, got %d", n)
+	}
+}
+
+func TestSubscriptionStats(t *testing.T) {
+	client := New()
+	newTestWsServer(t, client, func(ch *gosio.Channel) {
+		emitTrades(ch, 3)
+	})
+	tradeChan, stopChan := make(chan *Trade), make(chan bool)
+	doneChan := make(chan error)
+	start := time.Now()
+	go func() {
+		doneChan <- client.SubscribeTrades(tradeChan, stopChan)
+	}()
+	for i := 0; i < 6; i++ {
+		select {
+		case <-tradeChan:
+		case <-time.After(time.Second):
+			t.Fatalf("only %d trades received", i)
+		}
+		if i == 2 {
+			if stats := client.SubscriptionStats(); stats.Connections != 1 {
+				t.Errorf("expected 1 connection, got %d", stats.Connections)
+			}
+			stopChan <- false
+		}
+	}
+	close(stopChan)
+	if err := <-doneChan; err != nil {
+		t.Error(err)
+	}
+	stats := client.SubscriptionStats()
+	if stats.Messages != 6 || stats.Reconnects != 1 || stats.Connections != 0 || stats.Dropped != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if stats.LastMessage.Before(start) || stats.LastMessage.After(time.Now()) {
+		t.Errorf("unexpected last message time %v", stats.LastMessage)
+	}
+}
+
+func TestCoinsPaged(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`["BTC","ETH","LTC","XMR","ZEC"]`))
+	})
+	for _, tc := range []struct {
+		offset, limit int
+		want          string
+	}{
+		{offset: 0, limit: 2, want: "BTC,ETH"},
+		{offset: 2, limit: 2, want: "LTC,XMR"},
+		{offset: 4, limit: 2, want: "ZEC"},
+		{offset: 0, limit: 10, want: "BTC,ETH,LTC,XMR,ZEC"},
+		{offset: 3, limit: 0, want: ""},
+		{offset: 5, limit: 2, want: ""},
+		{offset: 100, limit: 2, want: ""},
+	} {
+		coins, err := client.CoinsPaged(tc.offset, tc.limit)
+		if err != nil {
+			t.Errorf("%d/%d: %v", tc.offset, tc.limit, err)
+		} else if coins == nil || strings.Join(coins, ",") != tc.want {
+			t.Errorf("%d/%d: expected %q, got %#v", tc.offset, tc.limit, tc.want, coins)
+		}
+	}
+	for _, tc := range [][2]int{{-1, 2}, {0, -1}} {
+		if _, err := client.CoinsPaged(tc[0], tc[1]); !errors.Is(err, ErrInvalidPaging) {
+			t.Errorf("%v: expected ErrInvalidPaging, got %v", tc, err)
+		}
+	}
+}
+
+func TestGzipResponse(t *testing.T) {
+	var acceptEncoding string
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		acceptEncoding = r.Header.Get("Accept-Encoding")
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte(`["BTC","ETH"]`))
+		gz.Close()
+	})
+	coins, err := client.Coins()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if acceptEncoding != "gzip" {
+		t.Errorf("expected Accept-Encoding gzip, got %q", acceptEncoding)
+	}
+	if len(coins) != 2 || coins[0] != "BTC" || coins[1] != "ETH" {
+		t.Errorf("unexpected coins: %v", coins)
+	}
+}
+
+func TestGetRaw(t *testing.T) {
+	var path string
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Header().Set("X-RateLimit-Remaining", "42")
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte(`{"BTCPrice":1}`))
+	})
+	resp, err := client.GetRaw(context.Background(), "global")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer resp.Body.Close()
+	if path != "/global" {
+		t.Errorf("unexpected path %q", path)
+	}
+	if resp.StatusCode != http.StatusTeapot {
+		t.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	if val := resp.Header.Get("X-RateLimit-Remaining"); val != "42" {
+		t.Errorf("unexpected rate limit header %q", val)
+	}
+	if body, err := ioutil.ReadAll(resp.Body); err != nil {
+		t.Error(err)
+	} else if string(body) != `{"BTCPrice":1}` {
+		t.Errorf("unexpected body %q", body)
+	}
+}
+
+func TestEmptyResponse(t *testing.T) {
+	for _, tc := range []struct {
+		body string
+		err  error
+	}{
+		{body: "", err: ErrEmptyResponse},
+		{body: "null", err: ErrEmptyResponse},
+		{body: " null\n", err: ErrEmptyResponse},
+		{body: "[]"},
+	} {
+		client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(tc.body))
+		})
+		coins, err := client.Coins()
+		if err != tc.err {
+			t.Errorf("%q: expected error %v, got %v", tc.body, tc.err, err)
+		} else if err == nil && (coins == nil || len(coins) != 0) {
+			t.Errorf("%q: expected empty non-nil slice, got %#v", tc.body, coins)
+		}
+	}
+}
+
+func TestHistoryInterval(t *testing.T) {
+	var path string
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write([]byte(`{}`))
+	})
+	for _, interval := range append(ValidIntervals(), HistoryIntervalAll) {
+		expected := "/history/" + interval + "/BTC"
+		if interval == HistoryIntervalAll {
+			expected = "/history/BTC"
+		}
+		if _, err := client.History("BTC", interval); err != nil {
+			t.Errorf("%q: %v", interval, err)
+		} else if path != expected {
+			t.Errorf("%q: expected path %q, got %q", interval, expected, path)
+		}
+	}
+	path = ""
+	if _, err := client.History("BTC", "1days"); !errors.Is(err, ErrInvalidInterval) {
+		t.Errorf("expected ErrInvalidInterval, got %v", err)
+	}
+	if path != "" {
+		t.Error("request with invalid interval was sent")
+	}
+}
+
+func TestSymbolEscaping(t *testing.T) {
+	var uri string
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		uri = r.RequestURI
+		w.Write([]byte(`{}`))
+	}, WithSymbolNormalization(false))
+	if _, err := client.Page("a b/../c"); err != nil {
+		t.Error(err)
+	} else if uri != "/page/a%20b%2F..%2Fc" {
+		t.Errorf("unexpected uri %q", uri)
+	}
+	if _, err := client.History(" BTC/", HistoryInterval1Day); err != nil {
+		t.Error(err)
+	} else if uri != "/history/1day/%20BTC%2F" {
+		t.Errorf("unexpected uri %q", uri)
+	}
+}
+
+func TestSymbolNormalization(t *testing.T) {
+	var path string
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write([]byte(`{}`))
+	})
+	for _, symb := range []string{"btc", " BTC", "Btc\t\n", "BTC"} {
+		if _, err := client.Page(symb); err != nil {
+			t.Error(err)
+		} else if path != "/page/BTC" {
+			t.Errorf("%q: unexpected path %q", symb, path)
+		}
+		if _, err := client.History(symb, HistoryInterval1Day); err != nil {
+			t.Error(err)
+		} else if path != "/history/1day/BTC" {
+			t.Errorf("%q: unexpected path %q", symb, path)
+		}
+	}
+	client = newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write([]byte(`{}`))
+	}, WithSymbolNormalization(false))
+	if _, err := client.Page("btc"); err != nil {
+		t.Error(err)
+	} else if path != "/page/btc" {
+		t.Errorf("unexpected path %q", path)
+	}
+}
+
+func TestPriceUSD(t *testing.T) {
+	client := newTestClient(t, serveFile(t, "page_btc.json"))
+	if price, err := client.PriceUSD(context.Background(), "BTC"); err != nil {
+		t.Error(err)
+	} else if price != 4330.16 {
+		t.Errorf("unexpected price %v", price)
+	}
+	client = newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"BTC"}`))
+	})
+	if _, err := client.PriceUSD(context.Background(), "BTC"); !errors.Is(err, ErrCurrencyUnavailable) {
+		t.Errorf("expected ErrCurrencyUnavailable, got %v", err)
+	}
+}
+
+func TestConcurrentRequests(t *testing.T) {
+	var requests int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		time.Sleep(time.Millisecond * 100)
+		w.Write([]byte(`{"BTCPrice":4000}`))
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if gl, err := client.Global(); err != nil {
+				t.Error(err)
+			} else if gl.BTCPrice != "4000" {
+				t.Errorf("unexpected price %q", gl.BTCPrice)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("expected 1 request, got %d", n)
+	}
+	if _, err := client.Global(); err != nil {
+		t.Error(err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("sequential requests must not be shared, got %d requests", n)
+	}
+}
+
+func TestGlobalHistory(t *testing.T) {
+	var path string
+	handler := serveFile(t, "history_global_1day.json")
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		handler(w, r)
+	})
+	hist, err := client.GlobalHistory(context.Background(), HistoryInterval1Day)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if path != "/history/1day/global" {
+		t.Errorf("unexpected path %q", path)
+	}
+	if len(hist.MarketCap) != 3 || len(hist.Volume) != 3 || len(hist.Price) != 0 {
+		t.Errorf("unexpected history %v", hist)
+	} else if hist.MarketCap[2][1] != "151027957142.9" {
+		t.Errorf("unexpected market cap %v", hist.MarketCap[2])
+	}
+	if _, err := client.GlobalHistory(context.Background(), "1days"); !errors.Is(err, ErrInvalidInterval) {
+		t.Errorf("expected ErrInvalidInterval, got %v", err)
+	}
+}
+
+func TestPing(t *testing.T) {
+	var path string
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write([]byte(`garbage`))
+	})
+	if err := client.Ping(context.Background()); err != nil {
+		t.Error(err)
+	} else if path != "/global" {
+		t.Errorf("unexpected path %q", path)
+	}
+	client = newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	if err := client.Ping(context.Background()); !errors.Is(err, ErrHTTPStatus) {
+		t.Errorf("expected http status error, got %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Close()
+	client = New()
+	client.apiURL = srv.URL + "/"
+	if err := client.Ping(context.Background()); !errors.Is(err, ErrNetwork) {
+		t.Errorf("expected network error, got %v", err)
+	}
+	// ping waits for a free slot like other requests.
+	client = New(WithMaxConcurrency(1))
+	client.inFlight <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	if err := client.Ping(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the ping to wait for a slot, got %v", err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`["BTC"]`))
+	}))
+	defer srv.Close()
+	client := New()
+	client.apiURL = srv.URL + "/"
+	newTestWsServer(t, client, func(ch *gosio.Channel) {})
+	before := runtime.NumGoroutine()
+	if _, err := client.Coins(); err != nil {
+		t.Error(err)
+	}
+	doneChan := make(chan error)
+	go func() {
+		doneChan <- client.SubscribeTrades(make(chan *Trade), make(chan bool))
+	}()
+	time.Sleep(time.Millisecond * 100)
+	client.Close()
+	select {
+	case err := <-doneChan:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Error("subscription was not stopped")
+	}
+	if _, err := client.Coins(); err != ErrClosed {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+	if err := client.SubscribeTrades(make(chan *Trade), make(chan bool)); err != ErrClosed {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+	var after int
+	for i := 0; i < 20; i++ {
+		if after = runtime.NumGoroutine(); after <= before {
+			return
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+	t.Errorf("goroutines leaked: %d before, %d after", before, after)
+}
+
+func TestContextVariants(t *testing.T) {
+	started := make(chan struct{}, 1)
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-r.Context().Done()
+	})
+	for name, call := range map[string]func(ctx context.Context) error{
+		"coins":         func(ctx context.Context) error { _, err := client.CoinsContext(ctx); return err },
+		"coins/xcp":     func(ctx context.Context) error { _, err := client.CoinsXCPContext(ctx); return err },
+		"coins/xcp/all": func(ctx context.Context) error { _, err := client.CoinsXCPAllContext(ctx); return err },
+		"map":           func(ctx context.Context) error { _, err := client.MapContext(ctx); return err },
+		"global":        func(ctx context.Context) error { _, err := client.GlobalContext(ctx); return err },
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-started
+			cancel()
+		}()
+		start := time.Now()
+		if err := call(ctx); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: expected canceled error, got %v", name, err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%s: request took %v", name, elapsed)
+		}
+		cancel()
+	}
+}
+
+// countingTransport counts connections made via the embedded websocket transport.
+type countingTransport struct {
+	*transport.WebsocketTransport
+	connects int32
+}
+
+func (t *countingTransport) Connect(url string) (transport.Connection, error) {
+	atomic.AddInt32(&t.connects, 1)
+	return t.WebsocketTransport.Connect(url)
+}
+
+// flakyTransport fails connects with given numbers, starting from 1, after the delay.
+// Other connects are made via the embedded websocket transport.
+type flakyTransport struct {
+	*transport.WebsocketTransport
+	failing  map[int32]bool
+	delay    time.Duration
+	connects int32
+}
+
+func (t *flakyTransport) Connect(url string) (transport.Connection, error) {
+	if n := atomic.AddInt32(&t.connects, 1); t.failing[n] {
+		time.Sleep(t.delay)
+		return nil, errors.Errorf("connect %d failed", n)
+	}
+	return t.WebsocketTransport.Connect(url)
+}
+
+func TestWebsocketTransport(t *testing.T) {
+	tr := transport.GetDefaultWebsocketTransport()
+	tr.PingInterval = time.Second
+	if client := New(WithWebsocketTransport(tr)); client.wsTransport != tr {
+		t.Error("custom transport is not set")
+	}
+	counting := &countingTransport{WebsocketTransport: tr}
+	client := New()
+	client.wsTransport = counting
+	newTestWsServer(t, client, func(ch *gosio.Channel) {
+		emitTrades(ch, 1)
+	})
+	tradeChan, stopChan := make(chan *Trade), make(chan bool)
+	doneChan := make(chan error)
+	go func() {
+		doneChan <- client.SubscribeTrades(tradeChan, stopChan)
+	}()
+	select {
+	case <-tradeChan:
+	case <-time.After(time.Second):
+		t.Error("no trades received")
+	}
+	close(stopChan)
+	if err := <-doneChan; err != nil {
+		t.Error(err)
+	}
+	if n := atomic.LoadInt32(&counting.connects); n != 1 {
+		t.Errorf("expected 1 connection via custom transport, got %d", n)
+	}
+}
+
+func TestSubscribeGracefulStop(t *testing.T) {
+	for _, graceful := range []bool{false, true} {
+		var opts []Option
+		if graceful {
+			opts = append(opts, WithGracefulStop(time.Second))
+		}
+		client := New(opts...)
+		newTestWsServer(t, client, func(ch *gosio.Channel) {
+			emitTrades(ch, 1)
+		})
+		tradeChan, stopChan := make(chan *Trade), make(chan bool)
+		doneChan := make(chan error)
+		go func() {
+			doneChan <- client.SubscribeTrades(tradeChan, stopChan)
+		}()
+		time.Sleep(time.Millisecond * 200) // the trade is received, but not read yet.
+		stopChan <- true
+		var received int
+		if !graceful {
+			// wait for the subscription to return before reading, so that the trade can only be dropped.
+			if err := <-doneChan; err != nil {
+				t.Error(err)
+			}
+			select {
+			case <-tradeChan:
+				received++
+			case <-time.After(time.Millisecond * 100):
+			}
+		}
+		for done := !graceful; !done; {
+			select {
+			case <-tradeChan:
+				received++
+			case err := <-doneChan:
+				if err != nil {
+					t.Error(err)
+				}
+				done = true
+			case <-time.After(time.Second * 2):
+				t.Fatal("subscription did not stop")
+			}
+		}
+		if graceful && received != 1 {
+			t.Errorf("expected the pending trade to be delivered, got %d trades", received)
+		} else if !graceful && received != 0 {
+			t.Errorf("expected the pending trade to be dropped, got %d trades", received)
+		}
+	}
+}
+
+func TestConnStateHandler(t *testing.T) {
+	stateChan := make(chan ConnState, 100)
+	client := New(WithConnStateHandler(func(state ConnState) {
+		stateChan <- state
+	}))
+	newTestWsServer(t, client, func(ch *gosio.Channel) {})
+	stopChan := make(chan bool)
+	doneChan := make(chan error)
+	go func() {
+		doneChan <- client.SubscribeTrades(make(chan *Trade), stopChan)
+	}()
+	expected := []ConnState{
+		ConnStateConnecting, ConnStateConnected, ConnStateDisconnected,
+		ConnStateReconnecting, ConnStateConnected, ConnStateDisconnected, ConnStateStopped,
+	}
+	for i, state := range expected {
+		select {
+		case got := <-stateChan:
+			if got != state {
+				t.Fatalf("%d: expected %v, got %v", i, state, got)
+			}
+		case <-time.After(time.Second * 2):
+			t.Fatalf("%d: no state change, expected %v", i, state)
+		}
+		switch i {
+		case 1:
+			stopChan <- false
+		case 4:
+			close(stopChan)
+		}
+	}
+	if err := <-doneChan; err != nil {
+		t.Error(err)
+	}
+	if ConnStateReconnecting.String() != "reconnecting" {
+		t.Errorf("unexpected name %q", ConnStateReconnecting)
+	}
+}
+
+func TestSubscribeTradesControl(t *testing.T) {
+	client := New()
+	var connections int32
+	newTestWsServer(t, client, func(ch *gosio.Channel) {
+		atomic.AddInt32(&connections, 1)
+		emitTrades(ch, 1)
+	})
+	for _, stop := range []func(ctrlChan chan Control){
+		func(ctrlChan chan Control) { ctrlChan <- ControlStop },
+		func(ctrlChan chan Control) { close(ctrlChan) },
+	} {
+		atomic.StoreInt32(&connections, 0)
+		tradeChan, ctrlChan := make(chan *Trade), make(chan Control)
+		doneChan := make(chan error)
+		go func() {
+			doneChan <- client.SubscribeTradesControl(tradeChan, ctrlChan)
+		}()
+		for i := 0; i < 2; i++ {
+			select {
+			case <-tradeChan:
+			case <-time.After(time.Second):
+				t.Fatalf("%d: no trades received", i)
+			}
+			if i == 0 {
+				ctrlChan <- Control(42) // ignored.
+				ctrlChan <- ControlReconnect
+			}
+		}
+		stop(ctrlChan)
+		select {
+		case err := <-doneChan:
+			if err != nil {
+				t.Error(err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("subscription was not stopped")
+		}
+		if n := atomic.LoadInt32(&connections); n != 2 {
+			t.Errorf("expected 2 connections, got %d", n)
+		}
+	}
+}
+
+func TestSubscribeTradesFor(t *testing.T) {
+	client := New()
+	newTestWsServer(t, client, func(ch *gosio.Channel) {
+		emitTrades(ch, 3)
+	})
+	tradeChan := make(chan *Trade, 10)
+	start := time.Now()
+	if err := client.SubscribeTradesFor(context.Background(), time.Millisecond*300, tradeChan); err != nil {
+		t.Error(err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Millisecond*300 || elapsed > time.Second {
+		t.Errorf("expected to stop after 300ms, took %v", elapsed)
+	}
+	if n := len(tradeChan); n != 3 {
+		t.Errorf("expected 3 trades, got %d", n)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	start = time.Now()
+	if err := client.SubscribeTradesFor(ctx, time.Minute, make(chan *Trade, 10)); err != context.DeadlineExceeded {
+		t.Errorf("expected context deadline error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected to stop on context deadline, took %v", elapsed)
+	}
+}
+
+// testMetrics counts reported events. It is safe for concurrent use.
+type testMetrics struct {
+	requests, messages, reconnects int32
+}
+
+func (m *testMetrics) RequestDone(path string, duration time.Duration, err error) {
+	atomic.AddInt32(&m.requests, 1)
+}
+
+func (m *testMetrics) MessageReceived(channel string) {
+	if channel == "trades" {
+		atomic.AddInt32(&m.messages, 1)
+	}
+}
+
+func (m *testMetrics) Reconnected() {
+	atomic.AddInt32(&m.reconnects, 1)
+}
+
+func TestMetrics(t *testing.T) {
+	m := &testMetrics{}
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}, WithMetrics(m))
+	newTestWsServer(t, client, func(ch *gosio.Channel) {
+		emitTrades(ch, 1)
+	})
+	client.Global()
+	client.Page("BTC")
+	tradeChan, stopChan := make(chan *Trade), make(chan bool)
+	doneChan := make(chan error)
+	go func() {
+		doneChan <- client.SubscribeTrades(tradeChan, stopChan)
+	}()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-tradeChan:
+		case <-time.After(time.Second):
+			t.Fatalf("only %d trades received", i)
+		}
+		if i == 0 {
+			stopChan <- false
+		}
+	}
+	close(stopChan)
+	if err := <-doneChan; err != nil {
+		t.Error(err)
+	}
+	if m.requests != 2 || m.messages != 2 || m.reconnects != 1 {
+		t.Errorf("unexpected metrics %+v", m)
+	}
+}
+
+func TestSkewWarning(t *testing.T) {
+	logger := &testLogger{}
+	client := New(WithLogger(logger), WithSkewWarning(time.Minute))
+	old := time.Now().Add(-time.Hour).UnixNano() / 1e6
+	newTestWsServer(t, client, func(ch *gosio.Channel) {
+		emitMessages(ch, "trades",
+			tradeMessage("bitfinex", "BTC_USD", "1", 4000),
+			json.RawMessage(fmt.Sprintf(`{"message":{"market_id":"BTC_USD"},"trade":{"data":{"timestamp_ms":%d,"raw":{"ID":"2"}}}}`, old)),
+		)
+	})
+	tradeChan, stopChan := make(chan *Trade), make(chan bool)
+	doneChan := make(chan error)
+	go func() {
+		doneChan <- client.SubscribeTrades(tradeChan, stopChan)
+	}()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-tradeChan:
+		case <-time.After(time.Second):
+			t.Fatalf("only %d trades received", i)
+		}
+	}
+	close(stopChan)
+	if err := <-doneChan; err != nil {
+		t.Error(err)
+	}
+	if !logger.contains("trade 2 on BTC_USD has time skew") || logger.contains("trade 1 ") {
+		t.Errorf("unexpected log %v", logger.lines)
+	}
+}
+
+func TestCoinDetail(t *testing.T) {
+	var paths []string
+	xcp, ethAll := serveFile(t, "coins_xcp.json"), serveFile(t, "coins_eth_all.json")
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		switch r.URL.Path {
+		case "/coins/xcp":
+			xcp(w, r)
+		case "/coins/eth/all":
+			ethAll(w, r)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	coins, err := client.CoinDetail(context.Background(), " XCP ")
+	if err != nil {
+		t.Error(err)
+	} else if len(coins) != 6 || coins[1] != "PEPECASH" {
+		t.Errorf("unexpected xcp coins %v", coins)
+	}
+	coins, err = client.CoinDetailAll(context.Background(), "eth")
+	if err != nil {
+		t.Error(err)
+	} else if len(coins) != 9 || coins[0] != "ETH" {
+		t.Errorf("unexpected eth coins %v", coins)
+	}
+	for _, symb := range []string{"", "  ", "eth/all", "../global", "x c p", "btc?x=1"} {
+		if _, err := client.CoinDetail(context.Background(), symb); !errors.Is(err, ErrInvalidSymbol) {
+			t.Errorf("expected invalid symbol error for %q, got %v", symb, err)
+		}
+	}
+	if len(paths) != 2 {
+		t.Errorf("invalid symbols must not be requested, got %v", paths)
+	}
+}
+
+func TestSubscribeTradesWithoutData(t *testing.T) {
+	const msg = `{"coin":"BTC","exchange_id":"bitfinex","market_id":"BTC_USD","msg":{"short":"BTC","price":4000}}`
+	client := New()
+	newTestWsServer(t, client, func(ch *gosio.Channel) {
+		emitMessages(ch, "trades",
+			tradeMessage("bitfinex", "BTC_USD", "1", 4000),
+			json.RawMessage(`{"message":`+msg+`}`),
+			json.RawMessage(`{"message":`+msg+`,"trade":null}`),
+			json.RawMessage(`{"message":`+msg+`,"trade":{}}`),
+			json.RawMessage(`{"message":`+msg+`,"trade":{"data":null}}`),
+		)
+	})
+	tradeChan, stopChan := make(chan *Trade), make(chan bool)
+	doneChan := make(chan error)
+	go func() {
+		doneChan <- client.SubscribeTrades(tradeChan, stopChan)
+	}()
+	for i := 0; i < 5; i++ {
+		select {
+		case trade := <-tradeChan:
+			if trade.Msg.MarketID != "BTC_USD" {
+				t.Errorf("%d: unexpected market %q", i, trade.Msg.MarketID)
+			}
+			if hasData := i == 0; trade.HasData != hasData {
+				t.Errorf("%d: expected HasData to be %v", i, hasData)
+			}
+			if !trade.HasData && trade.Data != (TradeData{}) {
+				t.Errorf("%d: expected zero data, got %+v", i, trade.Data)
+			}
+			if trade.HasData && trade.Data.Raw.ID != "1" {
+				t.Errorf("%d: unexpected trade id %q", i, trade.Data.Raw.ID)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("only %d trades received", i)
+		}
+	}
+	close(stopChan)
+	if err := <-doneChan; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSubscribeTradesMalformed(t *testing.T) {
+	client := New()
+	newTestWsServer(t, client, func(ch *gosio.Channel) {
+		emitMessages(ch, "trades",
+			tradeMessage("bitfinex", "BTC_USD", "1", 4000),
+			json.RawMessage(`{"message":[1,2,3]}`),
+			json.RawMessage(`{"message":{"coin":"BTC"},"trade":{"data":[1,2,3]}}`),
+			json.RawMessage(`{"message":{"coin":"BTC"},"trade":""}`),
+			tradeMessage("bitfinex", "BTC_USD", "panic", 4001),
+			tradeMessage("bitfinex", "BTC_USD", "2", 4002),
+		)
+	})
+	tradeChan, stopChan, errChan := make(chan *Trade), make(chan bool), make(chan error, 10)
+	sub := client.newSubscription()
+	sub.errChan = errChan
+	doneChan := make(chan error)
+	go func() {
+		doneChan <- client.subscribeTrades(sub, tradeChan, stopChan, func(trade *Trade) bool {
+			if trade.Data.Raw.ID == "panic" {
+				panic("bad trade")
+			}
+			return true
+		})
+	}()
+	for _, id := range []string{"1", "2"} {
+		select {
+		case trade := <-tradeChan:
+			if trade.Data.Raw.ID != id {
+				t.Errorf("expected trade %s, got %s", id, trade.Data.Raw.ID)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("trade %s was not received", id)
+		}
+	}
+	close(stopChan)
+	if err := <-doneChan; err != nil {
+		t.Error(err)
+	}
+	var decodeErrs, panics int
+	for len(errChan) > 0 {
+		err := <-errChan
+		switch {
+		case errors.Is(err, ErrDecode):
+			decodeErrs++
+		case strings.Contains(err.Error(), "panic"):
+			panics++
+		default:
+			t.Errorf("unexpected error %v", err)
+		}
+	}
+	if decodeErrs != 3 || panics != 1 {
+		t.Errorf("expected 3 decode errors and 1 panic, got %d and %d", decodeErrs, panics)
+	}
+	if n := client.SubscriptionStats().Reconnects; n != 0 {
+		t.Errorf("expected the connection to be kept, got %d reconnects", n)
+	}
+}
+
+func TestValidSymbol(t *testing.T) {
+	for _, symb := range []string{"BTC", "eth", "XRP2", "1ST", strings.Repeat("A", 32)} {
+		if err := ValidSymbol(symb); err != nil {
+			t.Errorf("%q: unexpected error %v", symb, err)
+		}
+	}
+	for _, symb := range []string{"", "   ", " BTC", "BTC/ETH", "..", "BTC?x=1", "BT C", "BTC%2F", "ВТС", strings.Repeat("A", 33)} {
+		if err := ValidSymbol(symb); !errors.Is(err, ErrInvalidSymbol) {
+			t.Errorf("%q: expected invalid symbol error, got %v", symb, err)
+		}
+	}
+	var requests int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte(`{}`))
+	})
+	if _, err := client.Page(" "); !errors.Is(err, ErrInvalidSymbol) {
+		t.Errorf("expected invalid symbol error, got %v", err)
+	}
+	if _, err := client.History("../global", HistoryInterval1Day); !errors.Is(err, ErrInvalidSymbol) {
+		t.Errorf("expected invalid symbol error, got %v", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 0 {
+		t.Errorf("invalid symbols must not be requested, got %d requests", n)
+	}
+}
+
+func TestReconnectHook(t *testing.T) {
+	errAbort := errors.New("abort")
+	var calls int32
+	client := New(WithStallTimeout(time.Millisecond*100), WithReconnectHook(func(ctx context.Context) error {
+		if atomic.AddInt32(&calls, 1) == 3 {
+			return errAbort
+		}
+		return nil
+	}))
+	var connections int32
+	newTestWsServer(t, client, func(ch *gosio.Channel) {
+		atomic.AddInt32(&connections, 1) // stay silent, so that the client reconnects on stall.
+	})
+	doneChan := make(chan error)
+	go func() {
+		doneChan <- client.SubscribeTrades(make(chan *Trade), make(chan bool))
+	}()
+	select {
+	case err := <-doneChan:
+		if !errors.Is(err, errAbort) {
+			t.Errorf("expected hook error, got %v", err)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("subscription was not aborted")
+	}
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Errorf("expected 3 hook calls, got %d", n)
+	}
+	if n := atomic.LoadInt32(&connections); n != 3 {
+		t.Errorf("expected 3 connections, got %d", n)
+	}
+}
+
+func TestReconnectHookStop(t *testing.T) {
+	canceled := make(chan struct{})
+	client := New(WithReconnectHook(func(ctx context.Context) error {
+		<-ctx.Done()
+		close(canceled)
+		return ctx.Err()
+	}))
+	newTestWsServer(t, client, func(ch *gosio.Channel) {})
+	stopChan, doneChan := make(chan bool), make(chan error)
+	go func() {
+		doneChan <- client.SubscribeTrades(make(chan *Trade), stopChan)
+	}()
+	time.Sleep(time.Millisecond * 100)
+	stopChan <- false // request a reconnect, the hook blocks it.
+	time.Sleep(time.Millisecond * 100)
+	close(stopChan)
+	select {
+	case err := <-doneChan:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("subscription did not stop")
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Error("hook context was not canceled")
+	}
+}
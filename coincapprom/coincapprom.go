@@ -0,0 +1,144 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+// Package coincapprom exports coincap client metrics to Prometheus.
+// It is a separate package, so that coincap does not depend on Prometheus.
+package coincapprom
+
+import (
+	"strings"
+	"time"
+
+	coincap "github.com/avdva/coincap-go"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "coincap"
+
+// Metrics implements coincap.Metrics, updating Prometheus collectors.
+// Requests are labeled with the endpoint, which is the first segment of the path, like "page" for "page/BTC".
+type Metrics struct {
+	requests   *prometheus.CounterVec
+	latency    *prometheus.HistogramVec
+	errors     *prometheus.CounterVec
+	messages   *prometheus.CounterVec
+	reconnects prometheus.Counter
+}
+
+var _ coincap.Metrics = (*Metrics)(nil)
+
+// New creates metrics and registers them in reg.
+// If the metrics are already registered in reg, e.g. by another client, the registered collectors are reused,
+// so that all such clients update the same metrics.
+func New(reg prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "requests_total",
+			Help:      "Number of API requests.",
+		}, []string{"endpoint"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "request_duration_seconds",
+			Help:      "Duration of API requests.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"endpoint"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "request_errors_total",
+			Help:      "Number of failed API requests by error type.",
+		}, []string{"endpoint", "type"}),
+		messages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "ws_messages_total",
+			Help:      "Number of received websocket messages.",
+		}, []string{"channel"}),
+		reconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "ws_reconnects_total",
+			Help:      "Number of websocket reconnects.",
+		}),
+	}
+	for _, c := range []prometheus.Collector{m.requests, m.latency, m.errors, m.messages, m.reconnects} {
+		err := reg.Register(c)
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			if !m.reuse(c, are.ExistingCollector) {
+				return nil, errors.Errorf("failed to register metrics: conflicting collector %T", are.ExistingCollector)
+			}
+		} else if err != nil {
+			return nil, errors.Wrap(err, "failed to register metrics")
+		}
+	}
+	return m, nil
+}
+
+// reuse replaces collector c of m with the existing one, which is already registered.
+// It returns false, if the existing collector is of another type.
+func (m *Metrics) reuse(c, existing prometheus.Collector) bool {
+	var ok bool
+	switch c {
+	case m.requests:
+		m.requests, ok = existing.(*prometheus.CounterVec)
+	case m.latency:
+		m.latency, ok = existing.(*prometheus.HistogramVec)
+	case m.errors:
+		m.errors, ok = existing.(*prometheus.CounterVec)
+	case m.messages:
+		m.messages, ok = existing.(*prometheus.CounterVec)
+	case m.reconnects:
+		m.reconnects, ok = existing.(prometheus.Counter)
+	}
+	return ok
+}
+
+// WithPrometheus returns an option, which makes a client export its metrics to reg.
+// Several clients may use the same reg, e.g. prometheus.DefaultRegisterer, sharing the metrics.
+// Like prometheus.MustRegister, it panics, if reg has other collectors with the same names.
+func WithPrometheus(reg prometheus.Registerer) coincap.Option {
+	m, err := New(reg)
+	if err != nil {
+		panic(err)
+	}
+	return coincap.WithMetrics(m)
+}
+
+// RequestDone implements coincap.Metrics.
+func (m *Metrics) RequestDone(path string, duration time.Duration, err error) {
+	endpoint := endpoint(path)
+	m.requests.WithLabelValues(endpoint).Inc()
+	m.latency.WithLabelValues(endpoint).Observe(duration.Seconds())
+	if err != nil {
+		m.errors.WithLabelValues(endpoint, errorType(err)).Inc()
+	}
+}
+
+// MessageReceived implements coincap.Metrics.
+func (m *Metrics) MessageReceived(channel string) {
+	m.messages.WithLabelValues(channel).Inc()
+}
+
+// Reconnected implements coincap.Metrics.
+func (m *Metrics) Reconnected() {
+	m.reconnects.Inc()
+}
+
+// endpoint returns the first segment of path without query parameters.
+func endpoint(path string) string {
+	if idx := strings.IndexAny(path, "/?"); idx >= 0 {
+		path = path[:idx]
+	}
+	return path
+}
+
+func errorType(err error) string {
+	switch {
+	case errors.Is(err, coincap.ErrNetwork):
+		return "network"
+	case errors.Is(err, coincap.ErrDecode):
+		return "decode"
+	case errors.Is(err, coincap.ErrHTTPStatus):
+		return "http_status"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincapprom
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	coincap "github.com/avdva/coincap-go"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// redirectTransport sends all requests to a test server.
+type redirectTransport struct {
+	target *url.URL
+}
+
+func (t redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = t.target.Scheme, t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestMetrics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/global":
+			w.Write([]byte(`{"BTCPrice":4000}`))
+		case "/page/BTC":
+			w.Write([]byte(`garbage`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	target, _ := url.Parse(srv.URL)
+	reg := prometheus.NewRegistry()
+	m, err := New(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := coincap.New(coincap.WithMetrics(m), coincap.WithTransport(redirectTransport{target: target}))
+	client.Global()
+	client.Page("BTC")
+	client.Page("ETH")
+	m.MessageReceived("trades")
+	m.Reconnected()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]*dto.MetricFamily)
+	for _, f := range families {
+		byName[f.GetName()] = f
+	}
+	value := func(name string, labels map[string]string) float64 {
+		f := byName[name]
+		if f == nil {
+			return -1
+		}
+	metrics:
+		for _, metric := range f.GetMetric() {
+			for _, lp := range metric.GetLabel() {
+				if labels[lp.GetName()] != lp.GetValue() {
+					continue metrics
+				}
+			}
+			if h := metric.GetHistogram(); h != nil {
+				return float64(h.GetSampleCount())
+			}
+			return metric.GetCounter().GetValue()
+		}
+		return 0
+	}
+	for _, tc := range []struct {
+		name   string
+		labels map[string]string
+		want   float64
+	}{
+		{name: "coincap_requests_total", labels: map[string]string{"endpoint": "global"}, want: 1},
+		{name: "coincap_requests_total", labels: map[string]string{"endpoint": "page"}, want: 2},
+		{name: "coincap_request_duration_seconds", labels: map[string]string{"endpoint": "page"}, want: 2},
+		{name: "coincap_request_errors_total", labels: map[string]string{"endpoint": "page", "type": "decode"}, want: 1},
+		{name: "coincap_request_errors_total", labels: map[string]string{"endpoint": "page", "type": "http_status"}, want: 1},
+		{name: "coincap_ws_messages_total", labels: map[string]string{"channel": "trades"}, want: 1},
+		{name: "coincap_ws_reconnects_total", want: 1},
+	} {
+		if got := value(tc.name, tc.labels); got != tc.want {
+			t.Errorf("%s%v: expected %v, got %v", tc.name, tc.labels, tc.want, got)
+		}
+	}
+	other, err := New(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.Reconnected()
+	if families, err = reg.Gather(); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		byName[f.GetName()] = f
+	}
+	if got := value("coincap_ws_reconnects_total", nil); got != 2 {
+		t.Errorf("expected shared reconnects counter, got %v", got)
+	}
+	conflicting := prometheus.NewRegistry()
+	conflicting.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "coincap_ws_reconnects_total", Help: "Other."}))
+	if _, err := New(conflicting); err == nil {
+		t.Error("expected conflicting registration error")
+	}
+}
+
+func TestWithPrometheus(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	coincap.New(WithPrometheus(reg), coincap.WithTimeout(time.Second))
+	coincap.New(WithPrometheus(reg), coincap.WithTimeout(time.Second))
+	if _, err := reg.Gather(); err != nil {
+		t.Error(err)
+	}
+}
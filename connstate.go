@@ -0,0 +1,95 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"sync"
+)
+
+// ConnState is a state of a websocket subscription connection. See WithConnStateHandler.
+type ConnState int
+
+const (
+	// ConnStateConnecting means, that the subscription is establishing its first connection.
+	ConnStateConnecting ConnState = iota
+	// ConnStateConnected means, that the connection is established, and messages are being received.
+	ConnStateConnected
+	// ConnStateDisconnected means, that the connection was closed or lost.
+	ConnStateDisconnected
+	// ConnStateReconnecting means, that the subscription is establishing a new connection after a disconnect.
+	ConnStateReconnecting
+	// ConnStateStopped means, that the subscription has returned. It is always the last state.
+	ConnStateStopped
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case ConnStateConnecting:
+		return "connecting"
+	case ConnStateConnected:
+		return "connected"
+	case ConnStateDisconnected:
+		return "disconnected"
+	case ConnStateReconnecting:
+		return "reconnecting"
+	case ConnStateStopped:
+		return "stopped"
+	default:
+		return "unknown"
+	}
+}
+
+// connStateNotifier calls a handler for state changes in a separate goroutine,
+// so that a slow handler never blocks a subscription. States are delivered in order.
+type connStateNotifier struct {
+	fn     func(state ConnState)
+	signal chan struct{}
+
+	mut    sync.Mutex
+	queue  []ConnState
+	closed bool
+}
+
+// newConnStateNotifier returns nil, if there is no handler. All the methods of nil notifier are no-op.
+func (c *Client) newConnStateNotifier() *connStateNotifier {
+	if c.connStateHandler == nil {
+		return nil
+	}
+	n := &connStateNotifier{fn: c.connStateHandler, signal: make(chan struct{}, 1)}
+	go n.run()
+	return n
+}
+
+func (n *connStateNotifier) run() {
+	for range n.signal {
+		n.mut.Lock()
+		queue, closed := n.queue, n.closed
+		n.queue = nil
+		n.mut.Unlock()
+		for _, state := range queue {
+			n.fn(state)
+		}
+		if closed {
+			return
+		}
+	}
+}
+
+func (n *connStateNotifier) notify(state ConnState) {
+	if n == nil {
+		return
+	}
+	n.mut.Lock()
+	defer n.mut.Unlock()
+	n.queue = append(n.queue, state)
+	n.closed = state == ConnStateStopped
+	select {
+	case n.signal <- struct{}{}:
+	default:
+	}
+}
+
+// stop sends ConnStateStopped. The notifier goroutine exits after delivering it.
+func (n *connStateNotifier) stop() {
+	n.notify(ConnStateStopped)
+}
@@ -0,0 +1,151 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// readJSON reads a single json value from r.
+// It returns ErrEmptyResponse, if there is no value, or it is 'null'.
+func readJSON(r io.Reader) ([]byte, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		if err == io.EOF {
+			return nil, ErrEmptyResponse
+		}
+		return nil, withClass(ErrDecode, errors.Wrap(err, "failed to decode request"))
+	}
+	if string(raw) == "null" {
+		return nil, ErrEmptyResponse
+	}
+	return raw, nil
+}
+
+// Decoder decodes json values. It may be used to plug in a faster json library, see WithDecoder.
+// Implementations must be safe for concurrent use, support json.Unmarshaler and json.Number,
+// and decode numbers into interface{} values as json.Number, like encoding/json does with UseNumber.
+type Decoder interface {
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// stdDecoder is the default Decoder, which uses encoding/json.
+type stdDecoder struct{}
+
+func (stdDecoder) Unmarshal(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// decodeOptions control decoding of replies.
+type decodeOptions struct {
+	// strict makes unknown fields an error. encoding/json is always used in this mode.
+	strict bool
+	// normalizeNumbers replaces empty and invalid json.Number values with NumberSentinel.
+	normalizeNumbers bool
+	// decoder, if not nil, is used instead of encoding/json.
+	decoder Decoder
+}
+
+// rawDecoder is implemented by values, which need custom decoding of replies.
+type rawDecoder interface {
+	decodeRaw(raw []byte, opts decodeOptions) error
+}
+
+// unmarshal decodes raw into value.
+func unmarshal(raw []byte, value interface{}, opts decodeOptions) error {
+	if d, ok := value.(rawDecoder); ok {
+		return d.decodeRaw(raw, opts)
+	}
+	if opts.normalizeNumbers {
+		normalized, err := normalizeNumbers(raw, reflect.TypeOf(value))
+		if err != nil {
+			return withClass(ErrDecode, errors.Wrap(err, "failed to decode request"))
+		}
+		raw = normalized
+	}
+	var err error
+	switch {
+	case opts.strict:
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		dec.DisallowUnknownFields()
+		err = dec.Decode(value)
+	case opts.decoder != nil:
+		err = opts.decoder.Unmarshal(raw, value)
+	default:
+		err = stdDecoder{}.Unmarshal(raw, value)
+	}
+	if err != nil {
+		return withClass(ErrDecode, errors.Wrap(err, "failed to decode request"))
+	}
+	return nil
+}
+
+// decode reads a json value from r exactly the same way, as Client does for API replies.
+func decode(r io.Reader, value interface{}) error {
+	raw, err := readJSON(r)
+	if err != nil {
+		return err
+	}
+	return unmarshal(raw, value, decodeOptions{})
+}
+
+// DecodeCoins decodes a recorded reply for /coins path.
+// Like all the Decode* functions, it returns ErrEmptyResponse, if r is empty or contains 'null'.
+func DecodeCoins(r io.Reader) ([]string, error) {
+	var result []string
+	if err := decode(r, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// DecodeMap decodes a recorded reply for /map path.
+func DecodeMap(r io.Reader) ([]Mapping, error) {
+	var result []Mapping
+	if err := decode(r, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// DecodeGlobal decodes a recorded reply for /global path.
+func DecodeGlobal(r io.Reader) (Global, error) {
+	var result Global
+	err := decode(r, &result)
+	return result, err
+}
+
+// DecodeFront decodes a recorded reply for /front path.
+func DecodeFront(r io.Reader) ([]Front, error) {
+	var result frontList
+	if err := decode(r, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// DecodePage decodes a recorded reply for /page path.
+func DecodePage(r io.Reader) (*Page, error) {
+	var result Page
+	if err := decode(r, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DecodeHistory decodes a recorded reply for /history path.
+func DecodeHistory(r io.Reader) (*History, error) {
+	var result History
+	if err := decode(r, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
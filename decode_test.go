@@ -0,0 +1,151 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	gosio "github.com/graarh/golang-socketio"
+)
+
+func TestDecodeFront(t *testing.T) {
+	const sample = `[{"long":"Bitcoin","short":"BTC","price":"4330.16","mktcap":71695838028,"vwapData":null}]`
+	fronts, err := DecodeFront(strings.NewReader(sample))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(fronts) != 1 || fronts[0].Short != "BTC" || fronts[0].Price != "4330.16" || fronts[0].Mktcap != "71695838028" {
+		t.Errorf("unexpected fronts %+v", fronts)
+	}
+	if fronts[0].VwapData != nil {
+		t.Errorf("expected nil vwap, got %v", *fronts[0].VwapData)
+	}
+}
+
+func TestDecodePage(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "page_btc.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	page, err := DecodePage(f)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if page.ID != "BTC" || page.DisplayName != "Bitcoin" || page.PriceEUR != "3667.7" || page.BTCPrice != "4330.16" {
+		t.Errorf("unexpected page %+v", page)
+	}
+}
+
+func TestDecodeHistory(t *testing.T) {
+	const sample = `{"price":[[1505260800000,4330.16]],"market_cap":[[1505260800000,71695838028]],"volume":[]}`
+	hist, err := DecodeHistory(strings.NewReader(sample))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(hist.Price) != 1 || hist.Price[0][0] != "1505260800000" || hist.MarketCap[0][1] != "71695838028" {
+		t.Errorf("unexpected history %+v", hist)
+	}
+}
+
+func TestDecodeOthers(t *testing.T) {
+	if coins, err := DecodeCoins(strings.NewReader(`["BTC","ETH"]`)); err != nil || len(coins) != 2 {
+		t.Errorf("unexpected coins %v, %v", coins, err)
+	}
+	if m, err := DecodeMap(strings.NewReader(`[{"name":"Bitcoin","symbol":"BTC","aliases":["XBT"]}]`)); err != nil || len(m) != 1 || m[0].Aliases[0] != "XBT" {
+		t.Errorf("unexpected map %v, %v", m, err)
+	}
+	if gl, err := DecodeGlobal(strings.NewReader(`{"btcPrice":"4330.16"}`)); err != nil || gl.BTCPrice != "4330.16" {
+		t.Errorf("unexpected global %v, %v", gl, err)
+	}
+	for _, sample := range []string{"", "null"} {
+		if _, err := DecodeFront(strings.NewReader(sample)); err != ErrEmptyResponse {
+			t.Errorf("%q: expected ErrEmptyResponse, got %v", sample, err)
+		}
+	}
+}
+
+// countingDecoder is a custom Decoder, which uses json.Unmarshal and counts calls.
+type countingDecoder struct {
+	calls int32
+}
+
+func (d *countingDecoder) Unmarshal(data []byte, v interface{}) error {
+	atomic.AddInt32(&d.calls, 1)
+	return json.Unmarshal(data, v)
+}
+
+func TestCustomDecoder(t *testing.T) {
+	d := &countingDecoder{}
+	client := newTestClient(t, serveFile(t, "page_btc.json"), WithDecoder(d))
+	page, err := client.Page("BTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := newTestClient(t, serveFile(t, "page_btc.json")).Page("BTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *page != *expected {
+		t.Errorf("custom decoder result %+v differs from the default %+v", page, expected)
+	}
+	if n := atomic.LoadInt32(&d.calls); n != 1 {
+		t.Errorf("expected 1 decoder call, got %d", n)
+	}
+
+	atomic.StoreInt32(&d.calls, 0)
+	client = New(WithDecoder(d))
+	newTestWsServer(t, client, func(ch *gosio.Channel) {
+		emitTrades(ch, 1)
+	})
+	tradeChan, stopChan := make(chan *Trade), make(chan bool)
+	doneChan := make(chan error)
+	go func() {
+		doneChan <- client.SubscribeTrades(tradeChan, stopChan)
+	}()
+	select {
+	case trade := <-tradeChan:
+		if !trade.HasData || trade.Data.Raw.ID != "1" || trade.Msg.Msg.Price != "4000" {
+			t.Errorf("unexpected trade %+v", trade)
+		}
+	case <-time.After(time.Second):
+		t.Error("no trades received")
+	}
+	close(stopChan)
+	if err := <-doneChan; err != nil {
+		t.Error(err)
+	}
+	// the message and its trade data.
+	if n := atomic.LoadInt32(&d.calls); n != 2 {
+		t.Errorf("expected 2 decoder calls, got %d", n)
+	}
+}
+
+func BenchmarkDecoder(b *testing.B) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "page_btc.json"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	for name, d := range map[string]Decoder{"default": nil, "custom": &countingDecoder{}} {
+		b.Run(name, func(b *testing.B) {
+			opts := decodeOptions{decoder: d}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var page Page
+				if err := unmarshal(data, &page, opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"container/list"
+	"sync"
+)
+
+// dedupKey identifies a trade.
+type dedupKey struct {
+	market string
+	id     string
+}
+
+// dedup remembers the last 'size' trade keys. It is safe for concurrent use.
+type dedup struct {
+	size    int
+	mut     sync.Mutex
+	order   *list.List // of dedupKey, most recent first.
+	entries map[dedupKey]*list.Element
+}
+
+func newDedup(size int) *dedup {
+	return &dedup{size: size, order: list.New(), entries: make(map[dedupKey]*list.Element, size)}
+}
+
+// seen records the trade and returns true, if it is among the last 'size' recorded trades.
+// Trades without id are never considered duplicate.
+func (d *dedup) seen(trade *Trade) bool {
+	if trade.Data.Raw.ID == "" {
+		return false
+	}
+	key := dedupKey{market: trade.Data.MarketID, id: trade.Data.Raw.ID}
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	if elem, found := d.entries[key]; found {
+		d.order.MoveToFront(elem)
+		return true
+	}
+	d.entries[key] = d.order.PushFront(key)
+	if d.order.Len() > d.size {
+		oldest := d.order.Back()
+		d.order.Remove(oldest)
+		delete(d.entries, oldest.Value.(dedupKey))
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"testing"
+	"time"
+
+	gosio "github.com/graarh/golang-socketio"
+)
+
+func dedupTrade(market, id string) *Trade {
+	var trade Trade
+	trade.Data.MarketID = market
+	trade.Data.Raw.ID = id
+	return &trade
+}
+
+func TestDedup(t *testing.T) {
+	dd := newDedup(2)
+	for i, tc := range []struct {
+		market, id string
+		seen       bool
+	}{
+		{"BTC_USD", "1", false},
+		{"BTC_USD", "1", true},
+		{"ETH_USD", "1", false},
+		{"BTC_USD", "2", false}, // evicts ETH_USD/1.
+		{"BTC_USD", "1", false},
+		{"BTC_USD", "2", true},
+		{"BTC_USD", "", false},
+		{"BTC_USD", "", false},
+	} {
+		if seen := dd.seen(dedupTrade(tc.market, tc.id)); seen != tc.seen {
+			t.Errorf("%d: expected %v, got %v", i, tc.seen, seen)
+		}
+	}
+	if dd.order.Len() != 2 || len(dd.entries) != 2 {
+		t.Errorf("expected 2 entries, got %d and %d", dd.order.Len(), len(dd.entries))
+	}
+}
+
+func TestSubscribeTradesDedup(t *testing.T) {
+	client := New(WithTradeDedup(16))
+	newTestWsServer(t, client, func(ch *gosio.Channel) {
+		emitMessages(ch, "trades",
+			tradeMessage("bitfinex", "BTC_USD", "1", 4000),
+			tradeMessage("bitfinex", "BTC_USD", "1", 4000),
+			tradeMessage("bitfinex", "ETH_USD", "1", 300),
+			tradeMessage("bitfinex", "BTC_USD", "2", 4001),
+			tradeMessage("bitfinex", "ETH_USD", "1", 300),
+		)
+	})
+	tradeChan, stopChan := make(chan *Trade, 5), make(chan bool)
+	doneChan := make(chan error)
+	go func() {
+		doneChan <- client.SubscribeTrades(tradeChan, stopChan)
+	}()
+	received := make(map[string]int)
+	for i := 0; i < 3; i++ {
+		select {
+		case trade := <-tradeChan:
+			received[trade.Data.MarketID+"/"+trade.Data.Raw.ID]++
+		case <-time.After(time.Second):
+			t.Fatalf("only %d trades received", i)
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for client.SubscriptionStats().Duplicates < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+	close(stopChan)
+	if err := <-doneChan; err != nil {
+		t.Error(err)
+	}
+	if len(tradeChan) != 0 {
+		t.Errorf("unexpected trades: %d", len(tradeChan))
+	}
+	for _, key := range []string{"BTC_USD/1", "BTC_USD/2", "ETH_USD/1"} {
+		if received[key] != 1 {
+			t.Errorf("expected one %s trade, got %d", key, received[key])
+		}
+	}
+	if stats := client.SubscriptionStats(); stats.Duplicates != 2 || stats.Messages != 5 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
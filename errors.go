@@ -0,0 +1,172 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Error classes of failed requests. Use errors.Is to check, if a request error belongs to a class.
+var (
+	// ErrNetwork means, that the request could not be performed: connection failure, timeout, or cancellation.
+	ErrNetwork = errors.New("network error")
+	// ErrDecode means, that the reply could not be read or decoded.
+	ErrDecode = errors.New("decode error")
+	// ErrHTTPStatus means, that coincap replied with a non-2xx http status. See HTTPStatusError.
+	ErrHTTPStatus = errors.New("http status error")
+)
+
+// HTTPStatusError is returned, if coincap replied with a non-2xx http status.
+type HTTPStatusError struct {
+	StatusCode int
+	// RetryAfter is the delay from Retry-After header of a 429 reply, or 0, if there is none.
+	RetryAfter time.Duration
+}
+
+// newHTTPStatusError returns HTTPStatusError for resp.
+func newHTTPStatusError(resp *http.Response) *HTTPStatusError {
+	err := &HTTPStatusError{StatusCode: resp.StatusCode}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		err.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+	return err
+}
+
+// parseRetryAfter parses the value of Retry-After header, which is either a number of seconds, or an http date.
+// It returns 0 for empty or invalid values, and dates in the past.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if len(value) == 0 {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("unexpected http status %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Is makes HTTPStatusError match ErrHTTPStatus.
+func (e *HTTPStatusError) Is(target error) bool {
+	return target == ErrHTTPStatus
+}
+
+// contentTypeSnippetSize is the max number of body bytes stored in ContentTypeError.
+const contentTypeSnippetSize = 256
+
+// ContentTypeError is returned, if coincap replied with a non-json content type,
+// like an html error page or a Cloudflare challenge.
+type ContentTypeError struct {
+	ContentType string
+	// Snippet is the beginning of the reply body.
+	Snippet string
+}
+
+func (e *ContentTypeError) Error() string {
+	return fmt.Sprintf("unexpected content type %q: %q", e.ContentType, e.Snippet)
+}
+
+// Is makes ContentTypeError match ErrDecode.
+func (e *ContentTypeError) Is(target error) bool {
+	return target == ErrDecode
+}
+
+// checkContentType returns ContentTypeError with the beginning of body, if contentType is not json.
+// Empty and text/plain content types are accepted, as coincap does not always set the right one.
+func checkContentType(contentType string, body io.Reader) error {
+	if len(contentType) == 0 {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil {
+		switch {
+		case mediaType == "application/json", strings.HasSuffix(mediaType, "+json"),
+			mediaType == "text/plain", mediaType == "text/javascript", mediaType == "application/javascript":
+			return nil
+		}
+	}
+	snippet, _ := ioutil.ReadAll(io.LimitReader(body, contentTypeSnippetSize))
+	return &ContentTypeError{ContentType: contentType, Snippet: strings.TrimSpace(string(snippet))}
+}
+
+// RequestIDError is returned by requests made with an ID, see WithRequestIDFunc.
+type RequestIDError struct {
+	RequestID string
+	Err       error
+}
+
+func (e *RequestIDError) Error() string {
+	return fmt.Sprintf("request %s: %v", e.RequestID, e.Err)
+}
+
+func (e *RequestIDError) Unwrap() error {
+	return e.Err
+}
+
+// Cause makes RequestIDError compatible with errors.Cause.
+func (e *RequestIDError) Cause() error {
+	return e.Err
+}
+
+// withRequestID wraps err with RequestIDError, if id is not empty.
+func withRequestID(err error, id string) error {
+	if err == nil || len(id) == 0 {
+		return err
+	}
+	return &RequestIDError{RequestID: id, Err: err}
+}
+
+// classError attaches an error class to an error. The message is not changed,
+// and the original error is still accessible via errors.Is and errors.As.
+type classError struct {
+	class error
+	err   error
+}
+
+func (e *classError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classError) Unwrap() error {
+	return e.err
+}
+
+// Cause makes classError compatible with errors.Cause.
+func (e *classError) Cause() error {
+	return e.err
+}
+
+func (e *classError) Is(target error) bool {
+	return target == e.class
+}
+
+func withClass(class, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classError{class: class, err: err}
+}
+
+// isTimeout returns true, if err is a network timeout, e.g. the one of the http client.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
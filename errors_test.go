@@ -0,0 +1,198 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestErrorClasses(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		handler http.HandlerFunc
+		class   error
+	}{
+		{
+			name: "network",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(time.Millisecond * 200)
+			},
+			class: ErrNetwork,
+		},
+		{
+			name: "decode",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"BTCPrice":`))
+			},
+			class: ErrDecode,
+		},
+		{
+			name: "type",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`["BTC"]`))
+			},
+			class: ErrDecode,
+		},
+		{
+			name: "status",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte(`{}`))
+			},
+			class: ErrHTTPStatus,
+		},
+	} {
+		client := newTestClient(t, tc.handler, WithTimeout(time.Millisecond*50))
+		_, err := client.Front()
+		if err == nil {
+			t.Errorf("%s: expected error", tc.name)
+			continue
+		}
+		for _, class := range []error{ErrNetwork, ErrDecode, ErrHTTPStatus} {
+			if got, want := errors.Is(err, class), class == tc.class; got != want {
+				t.Errorf("%s: errors.Is(%v, %v) = %v", tc.name, err, class, got)
+			}
+		}
+	}
+}
+
+func TestHTTPStatusError(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	_, err := client.Global()
+	var statusErr *HTTPStatusError
+	if !errors.As(err, &statusErr) {
+		t.Errorf("expected HTTPStatusError, got %v", err)
+	} else if statusErr.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("unexpected status %d", statusErr.StatusCode)
+	}
+	if err.Error() != "unexpected http status 429 Too Many Requests" {
+		t.Errorf("unexpected message %q", err)
+	}
+}
+
+func TestErrorClassCause(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {})
+	_, err := client.page(ctx, "BTC")
+	if !errors.Is(err, ErrNetwork) || !errors.Is(err, context.Canceled) {
+		t.Errorf("expected canceled network error, got %v", err)
+	}
+}
+
+func TestContentTypeError(t *testing.T) {
+	var accept string
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		accept = r.Header.Get("Accept")
+		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+		w.Write([]byte("\n<html><body>Checking your browser before accessing coincap.io</body></html>"))
+	})
+	_, err := client.Global()
+	if accept != "application/json" {
+		t.Errorf("unexpected Accept header %q", accept)
+	}
+	var ctErr *ContentTypeError
+	if !errors.As(err, &ctErr) {
+		t.Errorf("expected ContentTypeError, got %v", err)
+		return
+	}
+	if ctErr.ContentType != "text/html; charset=UTF-8" || !strings.HasPrefix(ctErr.Snippet, "<html><body>Checking") {
+		t.Errorf("unexpected error %+v", ctErr)
+	}
+	if !errors.Is(err, ErrDecode) {
+		t.Error("ContentTypeError must match ErrDecode")
+	}
+	for _, contentType := range []string{"application/json", "application/json; charset=utf-8", "text/plain", ""} {
+		client = newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header()["Content-Type"] = []string{contentType}
+			w.Write([]byte(`{"BTCPrice":1}`))
+		})
+		if _, err := client.Global(); err != nil {
+			t.Errorf("%q: %v", contentType, err)
+		}
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var n int32
+	var header string
+	var observed error
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("X-Request-ID")
+		w.WriteHeader(http.StatusBadGateway)
+	}, WithRequestIDFunc(func() string {
+		n++
+		return fmt.Sprintf("req-%d", n)
+	}), WithObserver(func(path string, duration time.Duration, err error) {
+		observed = err
+	}))
+	_, err := client.Global()
+	if header != "req-1" {
+		t.Errorf("unexpected X-Request-ID %q", header)
+	}
+	var idErr *RequestIDError
+	if !errors.As(err, &idErr) || idErr.RequestID != "req-1" {
+		t.Errorf("expected RequestIDError with req-1, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "req-1") || !errors.Is(err, ErrHTTPStatus) {
+		t.Errorf("unexpected error %v", err)
+	}
+	if observed != err {
+		t.Errorf("observer got %v", observed)
+	}
+	if _, err := client.Coins(); err == nil || !strings.Contains(err.Error(), "req-2") || header != "req-2" {
+		t.Errorf("expected a new id, got %v, header %q", err, header)
+	}
+}
+
+func TestRequestObserver(t *testing.T) {
+	var header string
+	var infos []RequestInfo
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("X-Request-ID")
+		if r.URL.Path == "/coins" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"BTCPrice":4000}`))
+	}, WithRequestIDFunc(func() string {
+		return fmt.Sprintf("req-%d", len(infos)+1)
+	}), WithRequestObserver(func(info RequestInfo) {
+		infos = append(infos, info)
+	}), WithCache(time.Minute))
+	client.Global()
+	client.Coins()
+	client.Global()
+	if err := client.Ping(context.Background()); err != nil {
+		t.Error(err)
+	}
+	expected := []RequestInfo{
+		{Path: "global", RequestID: "req-1"},
+		{Path: "coins", RequestID: "req-2"},
+		{Path: "global"}, // cached.
+		{Path: "global", RequestID: "req-4"},
+	}
+	if len(infos) != len(expected) {
+		t.Fatalf("expected %d requests, got %v", len(expected), infos)
+	}
+	for i, exp := range expected {
+		if infos[i].Path != exp.Path || infos[i].RequestID != exp.RequestID {
+			t.Errorf("%d: expected %s with id %q, got %s with %q", i, exp.Path, exp.RequestID, infos[i].Path, infos[i].RequestID)
+		}
+		if failed := exp.Path == "coins"; (infos[i].Err != nil) != failed {
+			t.Errorf("%d: unexpected error %v", i, infos[i].Err)
+		}
+	}
+	if header != "req-4" {
+		t.Errorf("unexpected X-Request-ID %q", header)
+	}
+}
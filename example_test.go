@@ -0,0 +1,36 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap_test
+
+import (
+	"fmt"
+
+	coincap "github.com/avdva/coincap-go"
+)
+
+// fakeAPI overrides Global and panics on all other requests.
+type fakeAPI struct {
+	coincap.API
+}
+
+func (fakeAPI) Global() (coincap.Global, error) {
+	return coincap.Global{BTCPrice: "4150.5"}, nil
+}
+
+// btcPrice is a code under test, which accepts coincap.API instead of *coincap.Client.
+func btcPrice(api coincap.API) (float64, error) {
+	gl, err := api.Global()
+	if err != nil {
+		return 0, err
+	}
+	return gl.BTCPrice.Float64()
+}
+
+func ExampleAPI() {
+	price, err := btcPrice(fakeAPI{})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(price)
+	// Output: 4150.5
+}
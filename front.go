@@ -0,0 +1,187 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// frontList is a reply for /front path, which may be either an array, or a single object.
+type frontList []Front
+
+func (l *frontList) decodeRaw(raw []byte, opts decodeOptions) error {
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '{' {
+		var f Front
+		if err := unmarshal(raw, &f, opts); err != nil {
+			return err
+		}
+		*l = frontList{f}
+		return nil
+	}
+	return unmarshal(raw, (*[]Front)(l), opts)
+}
+
+type frontCap struct {
+	front Front
+	cap   float64
+	// valid is false for empty market caps.
+	valid bool
+}
+
+// sortByMarketCap sorts fronts by market cap in descending order, empty caps go last.
+// If lenient is true, unparseable caps are treated as empty, otherwise an error is returned.
+func sortByMarketCap(fronts []Front, lenient bool) error {
+	caps := make([]frontCap, len(fronts))
+	for i, f := range fronts {
+		caps[i].front = f
+		if len(f.Mktcap) == 0 {
+			continue
+		}
+		val, err := f.Mktcap.Float64()
+		if err != nil {
+			if lenient {
+				continue
+			}
+			return errors.Wrapf(err, "failed to parse market cap of %s", f.Short)
+		}
+		caps[i].cap, caps[i].valid = val, true
+	}
+	sort.SliceStable(caps, func(i, j int) bool {
+		if caps[i].valid != caps[j].valid {
+			return caps[i].valid
+		}
+		return caps[i].cap > caps[j].cap
+	})
+	for i := range caps {
+		fronts[i] = caps[i].front
+	}
+	return nil
+}
+
+// SortFrontByMarketCap sorts fronts by market cap in descending order.
+// Fronts with empty market caps go last, keeping their original order.
+// If a market cap can't be parsed, an error is returned, and fronts are left unchanged.
+func SortFrontByMarketCap(fronts []Front) error {
+	return sortByMarketCap(fronts, false)
+}
+
+// TopN returns up to n fronts with the largest market caps in descending order.
+// Fronts with empty or unparseable market caps are considered the smallest.
+// The original slice is not modified.
+func TopN(fronts []Front, n int) []Front {
+	if n <= 0 {
+		return nil
+	}
+	sorted := make([]Front, len(fronts))
+	copy(sorted, fronts)
+	sortByMarketCap(sorted, true)
+	if n < len(sorted) {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+// RankByMarketCap returns 1-based ranks of fronts by market cap in descending order, keyed by Short symbol.
+// Fronts with equal market caps share the same rank, and the next rank is skipped, e.g. 1, 2, 2, 4.
+// Fronts with empty or unparseable market caps are not ranked.
+// If a symbol occurs several times, its best rank is used.
+func RankByMarketCap(fronts []Front) map[string]int {
+	sorted := make([]Front, len(fronts))
+	copy(sorted, fronts)
+	sortByMarketCap(sorted, true)
+	result := make(map[string]int, len(sorted))
+	var prevCap float64
+	rank := 0
+	for i, f := range sorted {
+		if len(f.Mktcap) == 0 {
+			break
+		}
+		mcap, err := f.Mktcap.Float64()
+		if err != nil {
+			break
+		}
+		if i == 0 || mcap != prevCap {
+			rank = i + 1
+		}
+		prevCap = mcap
+		if _, found := result[f.Short]; !found {
+			result[f.Short] = rank
+		}
+	}
+	return result
+}
+
+// FrontSnapshot is a reply for /front path together with the time it was received.
+type FrontSnapshot struct {
+	Fronts []Front
+	// FetchedAt is the time, when the reply was received from coincap.
+	// If the reply was taken from the cache, it is the time, when it was cached.
+	FetchedAt time.Time
+}
+
+// Age returns the time elapsed since the snapshot was received from coincap.
+func (s FrontSnapshot) Age() time.Duration {
+	return time.Since(s.FetchedAt)
+}
+
+// FrontAt works like Front, but also returns the time, when the reply was received,
+// so that stale data may be detected, e.g. during coincap outages, or if caching is enabled.
+func (c *Client) FrontAt(ctx context.Context) (FrontSnapshot, error) {
+	var result frontList
+	res, err := c.getRaw(ctx, "front", &result)
+	if err != nil {
+		return FrontSnapshot{}, err
+	}
+	return FrontSnapshot{Fronts: result, FetchedAt: res.fetched}, nil
+}
+
+// SymbolsWithCap requests /front path and returns market caps keyed by Short symbol.
+// Entries with empty or unparseable market caps are skipped.
+// If a symbol occurs several times, its largest market cap is used.
+func (c *Client) SymbolsWithCap(ctx context.Context) (map[string]float64, error) {
+	fronts, err := c.front(ctx, "front")
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]float64, len(fronts))
+	for _, f := range fronts {
+		if len(f.Mktcap) == 0 {
+			continue
+		}
+		mcap, err := f.Mktcap.Float64()
+		if err != nil {
+			continue
+		}
+		if prev, found := result[f.Short]; !found || mcap > prev {
+			result[f.Short] = mcap
+		}
+	}
+	return result, nil
+}
+
+// PercentChange returns the 24 hour price change from Perc field in whole percents, e.g. -1.5 for -1.5%.
+// coincap sends Perc and Cap24hrChange in whole percents, not fractions, so the value is returned as is.
+// If Perc is empty, an error wrapping ErrEmptyValue is returned.
+func (f Front) PercentChange() (float64, error) {
+	return parseNumber("percent change", f.Perc)
+}
+
+// WriteFrontJSONL writes fronts to w as JSON Lines: one compact json object per line.
+// Numbers are written exactly as received from coincap, as json.Number fields are never converted to floats.
+func WriteFrontJSONL(w io.Writer, fronts []Front) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, f := range fronts {
+		if err := enc.Encode(f); err != nil {
+			return errors.Wrapf(err, "failed to write %s", f.Short)
+		}
+	}
+	return nil
+}
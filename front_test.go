@@ -0,0 +1,269 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func frontSymbols(fronts []Front) []string {
+	result := make([]string, len(fronts))
+	for i, f := range fronts {
+		result[i] = f.Short
+	}
+	return result
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSortFrontByMarketCap(t *testing.T) {
+	fronts := []Front{
+		{Short: "NUL1"},
+		{Short: "ETH", Mktcap: "28000000000"},
+		{Short: "ZERO", Mktcap: "0"},
+		{Short: "BTC", Mktcap: "71695838028"},
+		{Short: "NUL2"},
+		{Short: "LTC", Mktcap: "2.5e9"},
+	}
+	if err := SortFrontByMarketCap(fronts); err != nil {
+		t.Error(err)
+		return
+	}
+	expected := []string{"BTC", "ETH", "LTC", "ZERO", "NUL1", "NUL2"}
+	if got := frontSymbols(fronts); !equalStrings(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	bad := []Front{{Short: "BTC", Mktcap: "1"}, {Short: "BAD", Mktcap: "x"}}
+	if err := SortFrontByMarketCap(bad); err == nil {
+		t.Error("expected parse error")
+	}
+}
+
+func TestTopN(t *testing.T) {
+	fronts := []Front{
+		{Short: "BAD", Mktcap: "x"},
+		{Short: "ETH", Mktcap: "28000000000"},
+		{Short: "NUL"},
+		{Short: "BTC", Mktcap: "71695838028"},
+	}
+	for _, tc := range []struct {
+		n        int
+		expected []string
+	}{
+		{n: 0, expected: []string{}},
+		{n: 1, expected: []string{"BTC"}},
+		{n: 3, expected: []string{"BTC", "ETH", "BAD"}},
+		{n: 10, expected: []string{"BTC", "ETH", "BAD", "NUL"}},
+	} {
+		if got := frontSymbols(TopN(fronts, tc.n)); !equalStrings(got, tc.expected) {
+			t.Errorf("%d: expected %v, got %v", tc.n, tc.expected, got)
+		}
+	}
+	if fronts[0].Short != "BAD" {
+		t.Error("original slice was modified")
+	}
+}
+
+func TestFrontJSONRoundTrip(t *testing.T) {
+	const data = `[{"cap24hrChange":-1.5,"long":"Bitcoin","mktcap":65000000000,"perc":-1.5,"price":3900.5,` +
+		`"shapeshift":true,"short":"BTC","supply":16600000,"usdVolume":1500000000,"volume":1500000000,` +
+		`"vwapData":3890.1,"vwapDataBTC":1},` +
+		`{"long":"Foo","short":"FOO","price":1,"cap24hrChange":0,"mktcap":0,"perc":0,"supply":0,"usdVolume":0,"volume":0}]`
+	var fronts []Front
+	if err := json.Unmarshal([]byte(data), &fronts); err != nil {
+		t.Error(err)
+		return
+	}
+	encoded, err := json.Marshal(fronts)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, name := range []string{`"usdVolume":1500000000`, `"cap24hrChange":-1.5`, `"vwapData":null`, `"vwapDataBTC":null`} {
+		if !strings.Contains(string(encoded), name) {
+			t.Errorf("%s not found in %s", name, encoded)
+		}
+	}
+	var decoded []Front
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(fronts, decoded) {
+		t.Errorf("expected %+v, got %+v", fronts, decoded)
+	}
+}
+
+func TestFrontPercentChange(t *testing.T) {
+	const data = `[{"short":"BTC","perc":-1.53,"cap24hrChange":-1.53},{"short":"ETH","perc":"12.5"},{"short":"FOO"}]`
+	var fronts []Front
+	if err := json.Unmarshal([]byte(data), &fronts); err != nil {
+		t.Error(err)
+		return
+	}
+	if val, err := fronts[0].PercentChange(); err != nil || val != -1.53 {
+		t.Errorf("expected -1.53, got %v, %v", val, err)
+	}
+	if val, err := fronts[1].PercentChange(); err != nil || val != 12.5 {
+		t.Errorf("expected 12.5, got %v, %v", val, err)
+	}
+	if _, err := fronts[2].PercentChange(); !errors.Is(err, ErrEmptyValue) {
+		t.Errorf("expected ErrEmptyValue, got %v", err)
+	}
+	if _, err := (Front{Perc: "n/a"}).PercentChange(); err == nil || errors.Is(err, ErrEmptyValue) {
+		t.Errorf("expected parse error, got %v", err)
+	}
+}
+
+func TestWriteFrontJSONL(t *testing.T) {
+	fronts := []Front{
+		{Short: "BTC", Long: "Bitcoin", Price: "3900.5", Mktcap: "65000000000", Supply: "16600000"},
+		{Short: "ETH", Long: "Ether <&>", Price: "0.00000123", Mktcap: "28000000000"},
+		{Short: "FOO"},
+	}
+	var buf bytes.Buffer
+	if err := WriteFrontJSONL(&buf, fronts); err != nil {
+		t.Error(err)
+		return
+	}
+	for _, substr := range []string{`"mktcap":65000000000`, `"price":0.00000123`, `"long":"Ether <&>"`} {
+		if !strings.Contains(buf.String(), substr) {
+			t.Errorf("%s not found in %s", substr, buf.String())
+		}
+	}
+	scanner := bufio.NewScanner(&buf)
+	var lines int
+	for ; scanner.Scan(); lines++ {
+		var f Front
+		if err := json.Unmarshal(scanner.Bytes(), &f); err != nil {
+			t.Errorf("line %d: %v", lines, err)
+		} else if lines < len(fronts) && f.Short != fronts[lines].Short {
+			t.Errorf("line %d: unexpected front %+v", lines, f)
+		}
+	}
+	if lines != len(fronts) {
+		t.Errorf("expected %d lines, got %d", len(fronts), lines)
+	}
+}
+
+func TestRankByMarketCap(t *testing.T) {
+	fronts := []Front{
+		{Short: "NUL"},
+		{Short: "LTC", Mktcap: "2500000000"},
+		{Short: "BTC", Mktcap: "71695838028"},
+		{Short: "BAD", Mktcap: "n/a"},
+		{Short: "XMR", Mktcap: "2.5e9"},
+		{Short: "ETH", Mktcap: "28000000000"},
+		{Short: "ZERO", Mktcap: "0"},
+	}
+	expected := map[string]int{"BTC": 1, "ETH": 2, "LTC": 3, "XMR": 3, "ZERO": 5}
+	if ranks := RankByMarketCap(fronts); !reflect.DeepEqual(ranks, expected) {
+		t.Errorf("expected %v, got %v", expected, ranks)
+	}
+	if fronts[0].Short != "NUL" {
+		t.Error("fronts were modified")
+	}
+	if ranks := RankByMarketCap(nil); len(ranks) != 0 {
+		t.Errorf("expected no ranks, got %v", ranks)
+	}
+}
+
+func TestFrontShapes(t *testing.T) {
+	for _, reply := range []string{
+		`[{"short":"BTC","price":4000},{"short":"ETH","price":300}]`,
+		` {"short":"BTC","price":4000}`,
+		`[]`,
+	} {
+		client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(reply))
+		})
+		for name, call := range map[string]func() ([]Front, error){"front": client.Front, "front/xcp": client.FrontXCP} {
+			fronts, err := call()
+			if err != nil {
+				t.Errorf("%s: %s: %v", name, reply, err)
+				continue
+			}
+			decoded, err := DecodeFront(strings.NewReader(reply))
+			if err != nil {
+				t.Errorf("%s: %v", reply, err)
+			}
+			if !reflect.DeepEqual(fronts, decoded) {
+				t.Errorf("%s: %s: request and decode results differ: %+v, %+v", name, reply, fronts, decoded)
+			}
+			if strings.HasPrefix(reply, "[]") {
+				if fronts == nil || len(fronts) != 0 {
+					t.Errorf("%s: expected empty slice, got %#v", name, fronts)
+				}
+			} else if fronts[0].Short != "BTC" || fronts[0].Price != "4000" {
+				t.Errorf("%s: %s: unexpected fronts %+v", name, reply, fronts)
+			}
+		}
+	}
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"short":"BTC","newField":1}`))
+	}, WithStrictDecoding(true))
+	if _, err := client.Front(); err == nil || !strings.Contains(err.Error(), "newField") {
+		t.Errorf("expected unknown field error, got %v", err)
+	}
+}
+
+func TestSymbolsWithCap(t *testing.T) {
+	client := newTestClient(t, serveFile(t, "front.json"))
+	caps, err := client.SymbolsWithCap(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]float64{"BTC": 71695838028, "ETH": 28754672130.5, "XRP": 7869340380}
+	if !reflect.DeepEqual(caps, expected) {
+		t.Errorf("expected %v, got %v", expected, caps)
+	}
+}
+
+func TestFrontAt(t *testing.T) {
+	client := newTestClient(t, serveFile(t, "front.json"), WithCache(time.Minute))
+	before := time.Now()
+	snap, err := client.FrontAt(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.Fronts) != 5 {
+		t.Errorf("expected 5 fronts, got %d", len(snap.Fronts))
+	}
+	if snap.FetchedAt.Before(before) || snap.FetchedAt.After(time.Now()) {
+		t.Errorf("unexpected fetch time %v", snap.FetchedAt)
+	}
+	if age := snap.Age(); age < 0 || age > time.Second {
+		t.Errorf("unexpected age %v", age)
+	}
+	time.Sleep(time.Millisecond * 100)
+	cached, err := client.FrontAt(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cached.FetchedAt.Equal(snap.FetchedAt) {
+		t.Errorf("expected the time of the cached reply %v, got %v", snap.FetchedAt, cached.FetchedAt)
+	}
+	if age := cached.Age(); age < time.Millisecond*100 {
+		t.Errorf("expected the cached snapshot to be at least 100ms old, got %v", age)
+	}
+}
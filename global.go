@@ -0,0 +1,147 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// DominanceTolerance is the max difference in percentage points
+// between computed and reported dominance, which is not considered a mismatch.
+const DominanceTolerance = 0.5
+
+// DominanceMismatchError is returned by ComputedDominance, if reported dominance differs from the computed one.
+type DominanceMismatchError struct {
+	Computed float64
+	Reported float64
+}
+
+func (e *DominanceMismatchError) Error() string {
+	return fmt.Sprintf("dominance mismatch: computed %.2f%%, reported %.2f%%", e.Computed, e.Reported)
+}
+
+// btcToUSD converts the value of a field, denominated in BTC, to USD using BTCPrice.
+func (g Global) btcToUSD(name string, n json.Number) (float64, error) {
+	val, err := parseNumber(name, n)
+	if err != nil {
+		return 0, err
+	}
+	price, err := parseNumber("btc price", g.BTCPrice)
+	if err != nil {
+		return 0, err
+	}
+	return val * price, nil
+}
+
+// VolumeAltUSD returns VolumeAlt, which is denominated in BTC, converted to USD.
+// If a field is empty, an error wrapping ErrEmptyValue is returned.
+func (g Global) VolumeAltUSD() (float64, error) {
+	return g.btcToUSD("alt volume", g.VolumeAlt)
+}
+
+// VolumeBTCUSD returns VolumeBtc, which is denominated in BTC, converted to USD.
+// If a field is empty, an error wrapping ErrEmptyValue is returned.
+func (g Global) VolumeBTCUSD() (float64, error) {
+	return g.btcToUSD("btc volume", g.VolumeBtc)
+}
+
+// VolumeTotalUSD returns VolumeTotal, which is denominated in BTC, converted to USD.
+// If a field is empty, an error wrapping ErrEmptyValue is returned.
+func (g Global) VolumeTotalUSD() (float64, error) {
+	return g.btcToUSD("total volume", g.VolumeTotal)
+}
+
+// ComputedDominance returns BTC dominance in percents, computed as BTCCap / TotalCap.
+// If Dom is not empty, and it differs from the computed value by more than DominanceTolerance,
+// the computed value is returned together with *DominanceMismatchError.
+func (g Global) ComputedDominance() (float64, error) {
+	btcCap, err := parseNumber("btc cap", g.BTCCap)
+	if err != nil {
+		return 0, err
+	}
+	totalCap, err := parseNumber("total cap", g.TotalCap)
+	if err != nil {
+		return 0, err
+	}
+	if totalCap == 0 {
+		return 0, errors.New("zero total cap")
+	}
+	computed := btcCap / totalCap * 100
+	if len(g.Dom) == 0 {
+		return computed, nil
+	}
+	reported, err := parseNumber("dominance", g.Dom)
+	if err != nil {
+		return computed, err
+	}
+	if math.Abs(computed-reported) > DominanceTolerance {
+		return computed, &DominanceMismatchError{Computed: computed, Reported: reported}
+	}
+	return computed, nil
+}
+
+// Delta is a change of a numeric field between two snapshots.
+type Delta struct {
+	// Abs is the absolute change: current - previous.
+	Abs float64
+	// Percent is the change relative to the previous value in percents. It is NaN, if the previous value is 0.
+	Percent float64
+	// Valid is false, if the field is empty in any of the snapshots. Abs and Percent are 0 in that case.
+	Valid bool
+}
+
+// GlobalDelta contains changes of Global fields.
+type GlobalDelta struct {
+	BTCPrice    Delta
+	BTCCap      Delta
+	AltCap      Delta
+	Dom         Delta
+	TotalCap    Delta
+	VolumeAlt   Delta
+	VolumeBtc   Delta
+	VolumeTotal Delta
+}
+
+// GlobalDiff computes changes of numeric fields between prev and cur snapshots.
+// Fields, which are empty in any of the snapshots, are not valid in the result.
+// An error is returned, if a field can't be parsed.
+func GlobalDiff(prev, cur Global) (GlobalDelta, error) {
+	var result GlobalDelta
+	for _, f := range []struct {
+		name      string
+		prev, cur json.Number
+		delta     *Delta
+	}{
+		{"btc price", prev.BTCPrice, cur.BTCPrice, &result.BTCPrice},
+		{"btc cap", prev.BTCCap, cur.BTCCap, &result.BTCCap},
+		{"alt cap", prev.AltCap, cur.AltCap, &result.AltCap},
+		{"dominance", prev.Dom, cur.Dom, &result.Dom},
+		{"total cap", prev.TotalCap, cur.TotalCap, &result.TotalCap},
+		{"alt volume", prev.VolumeAlt, cur.VolumeAlt, &result.VolumeAlt},
+		{"btc volume", prev.VolumeBtc, cur.VolumeBtc, &result.VolumeBtc},
+		{"total volume", prev.VolumeTotal, cur.VolumeTotal, &result.VolumeTotal},
+	} {
+		if len(f.prev) == 0 || len(f.cur) == 0 {
+			continue
+		}
+		p, err := parseNumber("previous "+f.name, f.prev)
+		if err != nil {
+			return GlobalDelta{}, err
+		}
+		c, err := parseNumber("current "+f.name, f.cur)
+		if err != nil {
+			return GlobalDelta{}, err
+		}
+		f.delta.Abs, f.delta.Valid = c-p, true
+		if p == 0 {
+			f.delta.Percent = math.NaN()
+		} else {
+			f.delta.Percent = (c - p) / math.Abs(p) * 100
+		}
+	}
+	return result, nil
+}
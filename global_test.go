@@ -0,0 +1,96 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"math"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestGlobalVolumesUSD(t *testing.T) {
+	gl := Global{BTCPrice: "4000", VolumeAlt: "1500.5", VolumeBtc: "2500", VolumeTotal: "4000.5"}
+	for _, tc := range []struct {
+		name string
+		fn   func() (float64, error)
+		want float64
+	}{
+		{name: "alt", fn: gl.VolumeAltUSD, want: 6002000},
+		{name: "btc", fn: gl.VolumeBTCUSD, want: 10000000},
+		{name: "total", fn: gl.VolumeTotalUSD, want: 16002000},
+	} {
+		if val, err := tc.fn(); err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		} else if math.Abs(val-tc.want) > 1e-6 {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, val)
+		}
+	}
+	if _, err := (Global{VolumeAlt: "1"}).VolumeAltUSD(); !errors.Is(err, ErrEmptyValue) {
+		t.Errorf("expected ErrEmptyValue for empty price, got %v", err)
+	}
+	if _, err := (Global{BTCPrice: "4000"}).VolumeAltUSD(); !errors.Is(err, ErrEmptyValue) {
+		t.Errorf("expected ErrEmptyValue for empty volume, got %v", err)
+	}
+}
+
+func TestGlobalComputedDominance(t *testing.T) {
+	gl := Global{BTCCap: "71695838028", TotalCap: "170666430763.22", Dom: "42.02"}
+	if val, err := gl.ComputedDominance(); err != nil {
+		t.Error(err)
+	} else if math.Abs(val-42.009) > 1e-3 {
+		t.Errorf("unexpected dominance %v", val)
+	}
+	gl.Dom = ""
+	if _, err := gl.ComputedDominance(); err != nil {
+		t.Errorf("unexpected error for empty dominance: %v", err)
+	}
+	gl.Dom = "50"
+	val, err := gl.ComputedDominance()
+	if mismatch, ok := err.(*DominanceMismatchError); !ok {
+		t.Errorf("expected mismatch error, got %v", err)
+	} else if mismatch.Reported != 50 || mismatch.Computed != val {
+		t.Errorf("unexpected mismatch %v", mismatch)
+	}
+	gl.TotalCap = "0"
+	if _, err := gl.ComputedDominance(); err == nil {
+		t.Error("expected an error for zero total cap")
+	}
+	if _, err := (Global{BTCCap: "1"}).ComputedDominance(); !errors.Is(err, ErrEmptyValue) {
+		t.Errorf("expected ErrEmptyValue, got %v", err)
+	}
+}
+
+func TestGlobalDiff(t *testing.T) {
+	prev := Global{BTCPrice: "4000", TotalCap: "150000000000", Dom: "50", VolumeTotal: "0", AltCap: "1"}
+	cur := Global{BTCPrice: "4200", TotalCap: "147000000000", Dom: "51.5", VolumeTotal: "100", VolumeAlt: "5"}
+	delta, err := GlobalDiff(prev, cur)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, tc := range []struct {
+		name         string
+		delta        Delta
+		abs, percent float64
+	}{
+		{name: "btc price", delta: delta.BTCPrice, abs: 200, percent: 5},
+		{name: "total cap", delta: delta.TotalCap, abs: -3000000000, percent: -2},
+		{name: "dominance", delta: delta.Dom, abs: 1.5, percent: 3},
+	} {
+		if !tc.delta.Valid || math.Abs(tc.delta.Abs-tc.abs) > 1e-6 || math.Abs(tc.delta.Percent-tc.percent) > 1e-9 {
+			t.Errorf("%s: expected %v, %v%%, got %+v", tc.name, tc.abs, tc.percent, tc.delta)
+		}
+	}
+	if d := delta.VolumeTotal; !d.Valid || d.Abs != 100 || !math.IsNaN(d.Percent) {
+		t.Errorf("unexpected volume delta %+v", d)
+	}
+	for _, d := range []Delta{delta.AltCap, delta.VolumeAlt, delta.BTCCap} {
+		if d.Valid || d.Abs != 0 || d.Percent != 0 {
+			t.Errorf("expected invalid delta, got %+v", d)
+		}
+	}
+	if _, err := GlobalDiff(prev, Global{BTCPrice: "4000x"}); err == nil {
+		t.Error("expected parse error")
+	}
+}
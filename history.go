@@ -0,0 +1,354 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// HistoryPoint contains values of all history series at some moment.
+// Missing values are NaN.
+type HistoryPoint struct {
+	Time      time.Time
+	Price     float64
+	MarketCap float64
+	Volume    float64
+}
+
+// seriesPoint is a parsed point of a history series.
+type seriesPoint struct {
+	ms    int64
+	value float64
+}
+
+// parseSeries parses [timestamp ms, value] pairs of a series.
+func parseSeries(name string, series [][2]json.Number) ([]seriesPoint, error) {
+	result := make([]seriesPoint, len(series))
+	for i, pair := range series {
+		ms, err := parseTimestampMs(pair[0])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid timestamp in %s series", name)
+		}
+		val, err := pair[1].Float64()
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid value in %s series", name)
+		}
+		result[i] = seriesPoint{ms: ms, value: val}
+	}
+	return result, nil
+}
+
+// parseTimestampMs parses a millisecond timestamp of a series point, which may be an integer or a float.
+func parseTimestampMs(n json.Number) (int64, error) {
+	ms, err := n.Int64()
+	if err != nil {
+		fms, ferr := n.Float64()
+		if ferr != nil {
+			return 0, err
+		}
+		ms = int64(fms)
+	}
+	return ms, nil
+}
+
+// Points joins Price, MarketCap and Volume series by timestamp.
+// Points are sorted by time. If a series has no value for a timestamp, it is NaN.
+// If a series has several values for the same timestamp, the last one is used.
+func (h *History) Points() ([]HistoryPoint, error) {
+	price, err := parseSeries("price", h.Price)
+	if err != nil {
+		return nil, err
+	}
+	mcap, err := parseSeries("market cap", h.MarketCap)
+	if err != nil {
+		return nil, err
+	}
+	vol, err := parseSeries("volume", h.Volume)
+	if err != nil {
+		return nil, err
+	}
+	byTime := make(map[int64]*HistoryPoint)
+	point := func(ms int64) *HistoryPoint {
+		p, found := byTime[ms]
+		if !found {
+			nan := math.NaN()
+			p = &HistoryPoint{Time: msToTime(ms), Price: nan, MarketCap: nan, Volume: nan}
+			byTime[ms] = p
+		}
+		return p
+	}
+	for _, sp := range price {
+		point(sp.ms).Price = sp.value
+	}
+	for _, sp := range mcap {
+		point(sp.ms).MarketCap = sp.value
+	}
+	for _, sp := range vol {
+		point(sp.ms).Volume = sp.value
+	}
+	result := make([]HistoryPoint, 0, len(byTime))
+	for _, p := range byTime {
+		result = append(result, *p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Time.Before(result[j].Time)
+	})
+	return result, nil
+}
+
+// Matrix returns history series as parallel slices, aligned by time, which may be used as gonum vectors.
+// times contains Unix timestamps in seconds, with milliseconds as the fractional part.
+// Alignment is the same as in Points: the slices have a value for every timestamp of any series,
+// sorted by time, and missing values are NaN. Use PointsInterpolated to fill them.
+func (h *History) Matrix() (times, price, mcap, vol []float64, err error) {
+	points, err := h.Points()
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	times, price = make([]float64, len(points)), make([]float64, len(points))
+	mcap, vol = make([]float64, len(points)), make([]float64, len(points))
+	for i, p := range points {
+		times[i] = float64(p.Time.UnixNano()/int64(time.Millisecond)) / 1000
+		price[i], mcap[i], vol[i] = p.Price, p.MarketCap, p.Volume
+	}
+	return times, price, mcap, vol, nil
+}
+
+// PointsInterpolated works like Points, but fills missing values.
+// A missing value between two known values of a series is linearly interpolated by time.
+// Missing values before the first or after the last known value are set to that value.
+// If a series is empty, its values remain NaN.
+func (h *History) PointsInterpolated() ([]HistoryPoint, error) {
+	points, err := h.Points()
+	if err != nil {
+		return nil, err
+	}
+	interpolate(points, func(p *HistoryPoint) *float64 { return &p.Price })
+	interpolate(points, func(p *HistoryPoint) *float64 { return &p.MarketCap })
+	interpolate(points, func(p *HistoryPoint) *float64 { return &p.Volume })
+	return points, nil
+}
+
+// interpolate fills NaN values of a series in time-sorted points. field returns a pointer to the series value.
+func interpolate(points []HistoryPoint, field func(p *HistoryPoint) *float64) {
+	prev := -1 // index of the previous known value.
+	for i := range points {
+		if math.IsNaN(*field(&points[i])) {
+			continue
+		}
+		if prev < 0 {
+			for j := 0; j < i; j++ {
+				*field(&points[j]) = *field(&points[i])
+			}
+		} else {
+			from, to := &points[prev], &points[i]
+			fromVal, toVal := *field(from), *field(to)
+			span := float64(to.Time.Sub(from.Time))
+			for j := prev + 1; j < i; j++ {
+				k := float64(points[j].Time.Sub(from.Time)) / span
+				*field(&points[j]) = fromVal + (toVal-fromVal)*k
+			}
+		}
+		prev = i
+	}
+	if prev < 0 {
+		return
+	}
+	for j := prev + 1; j < len(points); j++ {
+		*field(&points[j]) = *field(&points[prev])
+	}
+}
+
+// Resample aggregates history points into fixed-width time buckets.
+// Buckets are aligned to the unix epoch, so a point with timestamp t belongs to the bucket
+// [t - t mod bucket, t - t mod bucket + bucket). Each series is resampled independently,
+// the value of a bucket is the average of its points, the timestamp is the bucket start.
+// Empty buckets are omitted. bucket must be at least one millisecond.
+func (h *History) Resample(bucket time.Duration) (*History, error) {
+	width := int64(bucket / time.Millisecond)
+	if width <= 0 {
+		return nil, errors.Errorf("invalid bucket width %v", bucket)
+	}
+	var result History
+	var err error
+	if result.Price, err = resampleSeries("price", h.Price, width); err != nil {
+		return nil, err
+	}
+	if result.MarketCap, err = resampleSeries("market cap", h.MarketCap, width); err != nil {
+		return nil, err
+	}
+	if result.Volume, err = resampleSeries("volume", h.Volume, width); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func resampleSeries(name string, series [][2]json.Number, width int64) ([][2]json.Number, error) {
+	points, err := parseSeries(name, series)
+	if err != nil {
+		return nil, err
+	}
+	type bucketSum struct {
+		sum   float64
+		count int
+	}
+	buckets := make(map[int64]*bucketSum)
+	for _, sp := range points {
+		start := sp.ms - sp.ms%width
+		if sp.ms%width < 0 {
+			start -= width
+		}
+		b, found := buckets[start]
+		if !found {
+			b = &bucketSum{}
+			buckets[start] = b
+		}
+		b.sum += sp.value
+		b.count++
+	}
+	starts := make([]int64, 0, len(buckets))
+	for start := range buckets {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	result := make([][2]json.Number, len(starts))
+	for i, start := range starts {
+		b := buckets[start]
+		result[i] = [2]json.Number{
+			json.Number(strconv.FormatInt(start, 10)),
+			json.Number(strconv.FormatFloat(b.sum/float64(b.count), 'f', -1, 64)),
+		}
+	}
+	return result, nil
+}
+
+// Sorted returns a copy of h with all the series sorted by ascending timestamp.
+// Points with equal timestamps keep their server order, points with invalid timestamps are moved to the end.
+func (h *History) Sorted() *History {
+	return &History{
+		Price:     sortedSeries(h.Price),
+		MarketCap: sortedSeries(h.MarketCap),
+		Volume:    sortedSeries(h.Volume),
+	}
+}
+
+func sortedSeries(series [][2]json.Number) [][2]json.Number {
+	if series == nil {
+		return nil
+	}
+	type keyed struct {
+		ms    int64
+		valid bool
+	}
+	keys := make([]keyed, len(series))
+	for i, pair := range series {
+		ms, err := parseTimestampMs(pair[0])
+		keys[i] = keyed{ms: ms, valid: err == nil}
+	}
+	idx := make([]int, len(series))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		a, b := keys[idx[i]], keys[idx[j]]
+		if a.valid != b.valid {
+			return a.valid
+		}
+		return a.valid && a.ms < b.ms
+	})
+	result := make([][2]json.Number, len(series))
+	for i, from := range idx {
+		result[i] = series[from]
+	}
+	return result
+}
+
+// PriceSMA returns the simple moving average of the price series over period points.
+// Values are aligned with the price points sorted by timestamp, as in Sorted.
+// The first period-1 values are NaN, as there are not enough points to average.
+func (h *History) PriceSMA(period int) ([]float64, error) {
+	prices, err := sortedPrices(h, period)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]float64, len(prices))
+	var sum float64
+	for i, price := range prices {
+		sum += price
+		if i >= period {
+			sum -= prices[i-period]
+		}
+		if i < period-1 {
+			result[i] = math.NaN()
+		} else {
+			result[i] = sum / float64(period)
+		}
+	}
+	return result, nil
+}
+
+// PriceEMA returns the exponential moving average of the price series with smoothing factor 2/(period+1).
+// Values are aligned with the price points sorted by timestamp, as in Sorted.
+// The first period-1 values are NaN, the value at period-1 is the simple average of the first period points,
+// which seeds the exponential average.
+func (h *History) PriceEMA(period int) ([]float64, error) {
+	prices, err := sortedPrices(h, period)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]float64, len(prices))
+	k := 2 / float64(period+1)
+	var sum float64
+	for i, price := range prices {
+		switch {
+		case i < period-1:
+			sum += price
+			result[i] = math.NaN()
+		case i == period-1:
+			result[i] = (sum + price) / float64(period)
+		default:
+			result[i] = result[i-1] + k*(price-result[i-1])
+		}
+	}
+	return result, nil
+}
+
+// PriceChangePercent returns the change between the first and the last price of the history in percents
+// of the first one, e.g. 1.5 for a 1.5% rise. Points are ordered by time.
+// If there are less than 2 prices, an error wrapping ErrEmptyValue is returned.
+func (h *History) PriceChangePercent() (float64, error) {
+	prices, err := sortedPrices(h, 1)
+	if err != nil {
+		return 0, err
+	}
+	if len(prices) < 2 {
+		return 0, errors.Wrap(ErrEmptyValue, "price history")
+	}
+	first, last := prices[0], prices[len(prices)-1]
+	if first == 0 {
+		return 0, errors.New("zero first price")
+	}
+	return (last - first) / first * 100, nil
+}
+
+// sortedPrices returns price values sorted by timestamp. period must be positive.
+func sortedPrices(h *History, period int) ([]float64, error) {
+	if period < 1 {
+		return nil, errors.Errorf("invalid period %d", period)
+	}
+	points, err := parseSeries("price", sortedSeries(h.Price))
+	if err != nil {
+		return nil, err
+	}
+	result := make([]float64, len(points))
+	for i, sp := range points {
+		result[i] = sp.value
+	}
+	return result, nil
+}
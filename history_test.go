@@ -0,0 +1,268 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func pairs(values ...json.Number) [][2]json.Number {
+	var result [][2]json.Number
+	for i := 0; i+1 < len(values); i += 2 {
+		result = append(result, [2]json.Number{values[i], values[i+1]})
+	}
+	return result
+}
+
+func TestHistoryPoints(t *testing.T) {
+	hist := History{
+		Price:     pairs("3000", "30", "1000", "10", "2000", "20"),
+		MarketCap: pairs("1000", "100", "3000", "300"),
+		Volume:    pairs("2000", "2"),
+	}
+	points, err := hist.Points()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(points) != 3 {
+		t.Errorf("expected 3 points, got %v", points)
+		return
+	}
+	for i, p := range points {
+		if ms := p.Time.UnixNano() / 1e6; ms != int64(i+1)*1000 {
+			t.Errorf("%d: unexpected time %d", i, ms)
+		}
+		if p.Price != float64(i+1)*10 {
+			t.Errorf("%d: unexpected price %v", i, p.Price)
+		}
+	}
+	if !math.IsNaN(points[1].MarketCap) || !math.IsNaN(points[0].Volume) || !math.IsNaN(points[2].Volume) {
+		t.Errorf("expected NaN for missing values, got %+v", points)
+	}
+	hist.Volume = pairs("x", "1")
+	if _, err := hist.Points(); err == nil {
+		t.Error("expected parse error")
+	}
+}
+
+func TestHistoryMatrix(t *testing.T) {
+	hist := History{
+		Price:     pairs("1505260802500", "30", "1505260800000", "10", "1505260801000", "20"),
+		MarketCap: pairs("1505260800000", "100", "1505260802500", "300"),
+		Volume:    pairs("1505260801000", "2"),
+	}
+	times, price, mcap, vol, err := hist.Matrix()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(times) != 3 || len(price) != 3 || len(mcap) != 3 || len(vol) != 3 {
+		t.Fatalf("expected 3 values in all slices, got %d, %d, %d, %d", len(times), len(price), len(mcap), len(vol))
+	}
+	expectedTimes := []float64{1505260800, 1505260801, 1505260802.5}
+	for i := range times {
+		if times[i] != expectedTimes[i] {
+			t.Errorf("%d: expected time %v, got %v", i, expectedTimes[i], times[i])
+		}
+		if price[i] != float64(i+1)*10 {
+			t.Errorf("%d: unexpected price %v", i, price[i])
+		}
+	}
+	if mcap[0] != 100 || !math.IsNaN(mcap[1]) || mcap[2] != 300 {
+		t.Errorf("unexpected market caps %v", mcap)
+	}
+	if !math.IsNaN(vol[0]) || vol[1] != 2 || !math.IsNaN(vol[2]) {
+		t.Errorf("unexpected volumes %v", vol)
+	}
+	hist.Price = pairs("x", "1")
+	if _, _, _, _, err := hist.Matrix(); err == nil {
+		t.Error("expected parse error")
+	}
+}
+
+func TestHistoryPriceChangePercent(t *testing.T) {
+	hist := History{Price: pairs("1505260802500", "30", "1505260800000", "10", "1505260801000", "20")}
+	if val, err := hist.PriceChangePercent(); err != nil {
+		t.Error(err)
+	} else if val != 200 {
+		t.Errorf("unexpected change %v", val)
+	}
+	hist.Price = pairs("1505260800000", "0", "1505260801000", "20")
+	if _, err := hist.PriceChangePercent(); err == nil {
+		t.Error("expected an error for zero price")
+	}
+	hist.Price = pairs("1505260800000", "10")
+	if _, err := hist.PriceChangePercent(); !errors.Is(err, ErrEmptyValue) {
+		t.Errorf("expected ErrEmptyValue, got %v", err)
+	}
+}
+
+func TestHistoryPointsInterpolated(t *testing.T) {
+	hist := History{
+		Price:     pairs("1000", "10", "2000", "20", "3000", "30", "5000", "50"),
+		MarketCap: pairs("2000", "200", "5000", "500"),
+		Volume:    pairs("3000", "3"),
+	}
+	points, err := hist.PointsInterpolated()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := []struct{ price, mcap, vol float64 }{
+		{10, 200, 3}, // before the first market cap and volume.
+		{20, 200, 3},
+		{30, 300, 3}, // market cap interpolated.
+		{50, 500, 3}, // after the last volume.
+	}
+	if len(points) != len(expected) {
+		t.Errorf("expected %d points, got %v", len(expected), points)
+		return
+	}
+	for i, e := range expected {
+		p := points[i]
+		if p.Price != e.price || math.Abs(p.MarketCap-e.mcap) > 1e-9 || p.Volume != e.vol {
+			t.Errorf("%d: expected %v, got %+v", i, e, p)
+		}
+	}
+	hist.Volume = nil
+	if points, err = hist.PointsInterpolated(); err != nil {
+		t.Error(err)
+	} else if !math.IsNaN(points[0].Volume) {
+		t.Errorf("expected NaN for empty series, got %v", points[0].Volume)
+	}
+}
+
+func TestHistoryResample(t *testing.T) {
+	hist := History{
+		Price:     pairs("1505260800000", "10", "1505260859999", "20", "1505260860000", "30", "1505261040000", "40"),
+		MarketCap: pairs("1505260800001", "100"),
+	}
+	res, err := hist.Resample(time.Minute)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := [][2]json.Number{
+		{"1505260800000", "15"},
+		{"1505260860000", "30"},
+		{"1505261040000", "40"},
+	}
+	if !reflect.DeepEqual(res.Price, expected) {
+		t.Errorf("expected %v, got %v", expected, res.Price)
+	}
+	if expected := [][2]json.Number{{"1505260800000", "100"}}; !reflect.DeepEqual(res.MarketCap, expected) {
+		t.Errorf("expected %v, got %v", expected, res.MarketCap)
+	}
+	if len(res.Volume) != 0 {
+		t.Errorf("expected empty volume, got %v", res.Volume)
+	}
+	if _, err := hist.Resample(time.Microsecond); err == nil {
+		t.Error("expected error for invalid bucket")
+	}
+	hist.Price = pairs("x", "1")
+	if _, err := hist.Resample(time.Minute); err == nil {
+		t.Error("expected parse error")
+	}
+}
+
+func TestHistorySorted(t *testing.T) {
+	hist := History{
+		Price:     pairs("3000", "3", "1000", "1", "x", "0", "2000", "2a", "2000", "2b", "1500.0", "1.5"),
+		MarketCap: pairs("2", "b", "1", "a"),
+	}
+	sorted := hist.Sorted()
+	expected := pairs("1000", "1", "1500.0", "1.5", "2000", "2a", "2000", "2b", "3000", "3", "x", "0")
+	if !reflect.DeepEqual(sorted.Price, expected) {
+		t.Errorf("expected %v, got %v", expected, sorted.Price)
+	}
+	if expected := pairs("1", "a", "2", "b"); !reflect.DeepEqual(sorted.MarketCap, expected) {
+		t.Errorf("expected %v, got %v", expected, sorted.MarketCap)
+	}
+	if sorted.Volume != nil {
+		t.Errorf("expected nil volume, got %v", sorted.Volume)
+	}
+	if hist.Price[0][0] != "3000" {
+		t.Error("original history modified")
+	}
+}
+
+func TestHistoryMovingAverages(t *testing.T) {
+	hist := History{Price: pairs("3000", "12", "1000", "10", "2000", "11", "4000", "14", "6000", "16", "5000", "13")}
+	nan := math.NaN()
+	for _, tc := range []struct {
+		name     string
+		fn       func(period int) ([]float64, error)
+		expected []float64
+	}{
+		{name: "sma", fn: hist.PriceSMA, expected: []float64{nan, nan, 11, 37.0 / 3, 13, 43.0 / 3}},
+		{name: "ema", fn: hist.PriceEMA, expected: []float64{nan, nan, 11, 12.5, 12.75, 14.375}},
+	} {
+		values, err := tc.fn(3)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if len(values) != len(tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, values)
+			continue
+		}
+		for i, val := range values {
+			if exp := tc.expected[i]; math.IsNaN(exp) != math.IsNaN(val) || math.Abs(exp-val) > 1e-9 {
+				t.Errorf("%s: %d: expected %v, got %v", tc.name, i, exp, val)
+			}
+		}
+		if _, err := tc.fn(0); err == nil {
+			t.Errorf("%s: expected error for invalid period", tc.name)
+		}
+	}
+	if values, err := hist.PriceEMA(10); err != nil {
+		t.Error(err)
+	} else if len(values) != 6 || !math.IsNaN(values[5]) {
+		t.Errorf("expected only NaN values, got %v", values)
+	}
+}
+
+func TestPriceHistory(t *testing.T) {
+	var path string
+	handler := serveFile(t, "history_btc_1day.json")
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		handler(w, r)
+	})
+	points, err := client.PriceHistory(context.Background(), "btc", HistoryInterval1Day)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if path != "/history/1day/BTC" {
+		t.Errorf("unexpected path %q", path)
+	}
+	expected := []float64{4330.16, 4372.81, 4305.02}
+	if len(points) != len(expected) {
+		t.Errorf("expected %d points, got %v", len(expected), points)
+		return
+	}
+	for i, p := range points {
+		if ms := p.Time.UnixNano() / 1e6; ms != 1505260800000+int64(i)*3600000 {
+			t.Errorf("%d: unexpected time %d", i, ms)
+		}
+		if p.Price != expected[i] || !math.IsNaN(p.MarketCap) || !math.IsNaN(p.Volume) {
+			t.Errorf("%d: unexpected point %+v", i, p)
+		}
+	}
+	path = ""
+	if _, err := client.PriceHistory(context.Background(), "BTC", "1days"); !errors.Is(err, ErrInvalidInterval) {
+		t.Errorf("expected ErrInvalidInterval, got %v", err)
+	}
+	if path != "" {
+		t.Error("request with invalid interval was sent")
+	}
+}
@@ -0,0 +1,12 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+// Logger is used by Client to log websocket events. *log.Logger satisfies it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Printf(format string, v ...interface{}) {}
@@ -0,0 +1,159 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultSymbolIndexTTL is the time, during which HasSymbol reuses the index of /map path, if WithCache is not set.
+const defaultSymbolIndexTTL = time.Hour
+
+// SymbolIndex allows fast case-insensitive lookups in a list of mappings.
+type SymbolIndex struct {
+	bySymbol map[string]Mapping
+	byAlias  map[string]Mapping
+}
+
+// NewSymbolIndex builds an index from the result of Map().
+// If several mappings share a symbol or an alias, the first one wins.
+func NewSymbolIndex(mappings []Mapping) *SymbolIndex {
+	idx := &SymbolIndex{
+		bySymbol: make(map[string]Mapping, len(mappings)),
+		byAlias:  make(map[string]Mapping),
+	}
+	for _, m := range mappings {
+		key := strings.ToUpper(m.Symbol)
+		if _, found := idx.bySymbol[key]; !found {
+			idx.bySymbol[key] = m
+		}
+		for _, alias := range m.Aliases {
+			key = strings.ToUpper(alias)
+			if _, found := idx.byAlias[key]; !found {
+				idx.byAlias[key] = m
+			}
+		}
+	}
+	return idx
+}
+
+// BySymbol returns a mapping for given symbol.
+func (idx *SymbolIndex) BySymbol(sym string) (Mapping, bool) {
+	m, found := idx.bySymbol[strings.ToUpper(sym)]
+	return m, found
+}
+
+// ByAlias returns a mapping, which has given alias.
+func (idx *SymbolIndex) ByAlias(alias string) (Mapping, bool) {
+	m, found := idx.byAlias[strings.ToUpper(alias)]
+	return m, found
+}
+
+// CoinInfo is a Front entry joined with its mapping.
+type CoinInfo struct {
+	Front
+	// Mapping is nil, if no mapping was found for the coin.
+	Mapping *Mapping
+}
+
+// JoinFrontMap joins the results of Front() and Map(), preserving the order of fronts.
+// A front is matched to a mapping by its symbol, then by its symbol or long name as an alias.
+func JoinFrontMap(fronts []Front, mappings []Mapping) []CoinInfo {
+	idx := NewSymbolIndex(mappings)
+	result := make([]CoinInfo, len(fronts))
+	for i, f := range fronts {
+		result[i].Front = f
+		m, found := idx.BySymbol(f.Short)
+		if !found {
+			m, found = idx.ByAlias(f.Short)
+		}
+		if !found && f.Long != "" {
+			m, found = idx.ByAlias(f.Long)
+		}
+		if found {
+			result[i].Mapping = &m
+		}
+	}
+	return result
+}
+
+// symbolIndexCache keeps the index of /map path for HasSymbol.
+type symbolIndexCache struct {
+	mut     sync.Mutex
+	idx     *SymbolIndex
+	expires time.Time
+}
+
+// symbolIndex returns the index of /map path, requesting it, if the cached one is missing or expired.
+func (c *Client) symbolIndex(ctx context.Context) (*SymbolIndex, error) {
+	c.symbols.mut.Lock()
+	idx, expires := c.symbols.idx, c.symbols.expires
+	c.symbols.mut.Unlock()
+	if idx != nil && time.Now().Before(expires) {
+		return idx, nil
+	}
+	mappings, err := c.MapContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	idx = NewSymbolIndex(mappings)
+	ttl := defaultSymbolIndexTTL
+	if c.cache != nil {
+		ttl = c.cache.ttl
+	}
+	c.symbols.mut.Lock()
+	c.symbols.idx, c.symbols.expires = idx, time.Now().Add(ttl)
+	c.symbols.mut.Unlock()
+	return idx, nil
+}
+
+// HasSymbol returns whether symbol is a known coin symbol or alias according to /map path.
+// The check is case-insensitive. The index of /map is kept by the client for the ttl of WithCache,
+// or for an hour, if there is no cache, so /map is not requested on every call.
+func (c *Client) HasSymbol(ctx context.Context, symbol string) (bool, error) {
+	idx, err := c.symbolIndex(ctx)
+	if err != nil {
+		return false, err
+	}
+	symbol = strings.TrimSpace(symbol)
+	if _, found := idx.BySymbol(symbol); found {
+		return true, nil
+	}
+	_, found := idx.ByAlias(symbol)
+	return found, nil
+}
+
+// Catalog returns all the known coins: mappings from /map path, followed by the coins from /coins path,
+// which have no mapping, in their original order. Mappings from /map take precedence:
+// a coin is considered mapped, if its symbol matches a mapping symbol or alias, case-insensitively.
+// Unmapped coins have their symbol as the name and no aliases.
+func (c *Client) Catalog(ctx context.Context) ([]Mapping, error) {
+	mappings, err := c.MapContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	coins, err := c.CoinsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	idx := NewSymbolIndex(mappings)
+	result := make([]Mapping, len(mappings), len(mappings)+len(coins))
+	copy(result, mappings)
+	added := make(map[string]bool)
+	for _, symb := range coins {
+		if _, found := idx.BySymbol(symb); found {
+			continue
+		}
+		if _, found := idx.ByAlias(symb); found {
+			continue
+		}
+		if key := strings.ToUpper(symb); !added[key] {
+			added[key] = true
+			result = append(result, Mapping{Name: symb, Symbol: symb})
+		}
+	}
+	return result, nil
+}
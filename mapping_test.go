@@ -0,0 +1,136 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSymbolIndex(t *testing.T) {
+	idx := NewSymbolIndex([]Mapping{
+		{Name: "Bitcoin", Symbol: "BTC", Aliases: []string{"XBT", "bitcoin"}},
+		{Name: "Ethereum", Symbol: "ETH", Aliases: []string{"ether"}},
+	})
+	if m, found := idx.BySymbol("btc"); !found || m.Name != "Bitcoin" {
+		t.Errorf("unexpected mapping %v for btc", m)
+	}
+	if m, found := idx.BySymbol("ETH"); !found || m.Name != "Ethereum" {
+		t.Errorf("unexpected mapping %v for ETH", m)
+	}
+	if m, found := idx.ByAlias("xbt"); !found || m.Symbol != "BTC" {
+		t.Errorf("unexpected mapping %v for xbt", m)
+	}
+	if m, found := idx.ByAlias("Ether"); !found || m.Symbol != "ETH" {
+		t.Errorf("unexpected mapping %v for Ether", m)
+	}
+	if _, found := idx.BySymbol("XBT"); found {
+		t.Error("alias found as a symbol")
+	}
+	if _, found := idx.ByAlias("LTC"); found {
+		t.Error("unknown alias found")
+	}
+}
+
+func TestJoinFrontMap(t *testing.T) {
+	mappings := []Mapping{
+		{Name: "Bitcoin", Symbol: "BTC", Aliases: []string{"XBT"}},
+		{Name: "Ethereum", Symbol: "ETH", Aliases: []string{"Ether"}},
+		{Name: "Tether", Symbol: "USDT"},
+	}
+	fronts := []Front{
+		{Short: "btc", Long: "Bitcoin"},
+		{Short: "XBT"},
+		{Short: "ETHX", Long: "ether"},
+		{Short: "FOO", Long: "Foo"},
+	}
+	coins := JoinFrontMap(fronts, mappings)
+	if len(coins) != len(fronts) {
+		t.Fatalf("expected %d coins, got %d", len(fronts), len(coins))
+	}
+	for i, want := range []string{"BTC", "BTC", "ETH", ""} {
+		if coins[i].Short != fronts[i].Short {
+			t.Errorf("%d: unexpected front %+v", i, coins[i].Front)
+		}
+		switch {
+		case want == "" && coins[i].Mapping != nil:
+			t.Errorf("%d: expected no mapping, got %+v", i, coins[i].Mapping)
+		case want != "" && (coins[i].Mapping == nil || coins[i].Mapping.Symbol != want):
+			t.Errorf("%d: expected %s mapping, got %+v", i, want, coins[i].Mapping)
+		}
+	}
+}
+
+func TestHasSymbol(t *testing.T) {
+	var requests int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte(`[{"name":"Bitcoin","symbol":"BTC","aliases":["XBT"]},{"name":"Ethereum","symbol":"ETH","aliases":[]}]`))
+	})
+	for symb, want := range map[string]bool{"BTC": true, "eth": true, " xbt": true, "LTC": false, "": false} {
+		if found, err := client.HasSymbol(context.Background(), symb); err != nil {
+			t.Error(err)
+		} else if found != want {
+			t.Errorf("%q: expected %v, got %v", symb, want, found)
+		}
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("expected 1 request, got %d", n)
+	}
+	// an expired index is requested again.
+	client.symbols.expires = time.Now().Add(-time.Second)
+	if found, err := client.HasSymbol(context.Background(), "BTC"); err != nil || !found {
+		t.Errorf("expected BTC to be found, got %v, %v", found, err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("expected 2 requests, got %d", n)
+	}
+	// the index is kept for the ttl of the cache.
+	client = newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte(`[{"name":"Bitcoin","symbol":"BTC","aliases":["XBT"]}]`))
+	}, WithCache(time.Minute))
+	if _, err := client.HasSymbol(context.Background(), "BTC"); err != nil {
+		t.Error(err)
+	}
+	if ttl := client.symbols.expires.Sub(time.Now()); ttl > time.Minute || ttl < time.Second*50 {
+		t.Errorf("expected the index to expire in a minute, got %v", ttl)
+	}
+	client = newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	if _, err := client.HasSymbol(context.Background(), "BTC"); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/map":
+			w.Write([]byte(`[{"name":"Bitcoin","symbol":"BTC","aliases":["XBT"]},{"name":"Ethereum","symbol":"ETH"}]`))
+		case "/coins":
+			w.Write([]byte(`["ETH","NEW","btc","XBT","NEW","ZEC"]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	catalog, err := client.Catalog(context.Background())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := []Mapping{
+		{Name: "Bitcoin", Symbol: "BTC", Aliases: []string{"XBT"}},
+		{Name: "Ethereum", Symbol: "ETH"},
+		{Name: "NEW", Symbol: "NEW"},
+		{Name: "ZEC", Symbol: "ZEC"},
+	}
+	if !reflect.DeepEqual(catalog, expected) {
+		t.Errorf("expected %+v, got %+v", expected, catalog)
+	}
+}
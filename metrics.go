@@ -0,0 +1,31 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"time"
+)
+
+// RequestInfo describes a finished API request, see WithRequestObserver.
+type RequestInfo struct {
+	// Path is the API path of the request, like "page/BTC".
+	Path     string
+	Duration time.Duration
+	// RequestID is the ID of the request, see WithRequestIDFunc.
+	// It is empty, if request IDs are disabled, or the reply was served from the cache.
+	RequestID string
+	// Err is the resulting error, if any.
+	Err error
+}
+
+// Metrics receives events of a client. It may be used to export metrics to a monitoring system
+// without adding its dependencies to this package. See the coincapprom package for Prometheus.
+// Methods may be called concurrently and must not block.
+type Metrics interface {
+	// RequestDone is called after every API request with the request path, its duration and the resulting error, if any.
+	RequestDone(path string, duration time.Duration, err error)
+	// MessageReceived is called for every websocket message received on given channel, like "trades".
+	MessageReceived(channel string)
+	// Reconnected is called on every websocket reconnect.
+	Reconnected()
+}
@@ -0,0 +1,216 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrEmptyValue is returned by helpers, if a field required for computation is empty.
+var ErrEmptyValue = errors.New("empty value")
+
+// parseNumber parses a field with given name.
+// It returns an error wrapping ErrEmptyValue, if the field is empty.
+func parseNumber(name string, n json.Number) (float64, error) {
+	if len(n) == 0 {
+		return 0, errors.Wrap(ErrEmptyValue, name)
+	}
+	val, err := n.Float64()
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to parse %s", name)
+	}
+	return val, nil
+}
+
+// FloatOrZero returns n as float64, or 0, if n is empty or can't be parsed.
+// It is handy for displaying values, when a missing value and zero may be treated the same.
+// Use n.Float64() to detect invalid values.
+func FloatOrZero(n json.Number) float64 {
+	val, err := n.Float64()
+	if err != nil {
+		return 0
+	}
+	return val
+}
+
+// MustFloat returns n as float64 and panics, if n can't be parsed.
+// It should be used only for known-good values, like test data.
+func MustFloat(n json.Number) float64 {
+	val, err := n.Float64()
+	if err != nil {
+		panic(err)
+	}
+	return val
+}
+
+// bigFloatPrecision is the mantissa precision in bits of values returned by BigFloat.
+const bigFloatPrecision = 256
+
+// BigFloat parses n as a big.Float with 256-bit precision, so that large values, like market caps,
+// are not rounded as float64 values are. Use BigRat for exact decimal values.
+// It returns ErrEmptyValue, if n is empty.
+func BigFloat(n json.Number) (*big.Float, error) {
+	if len(n) == 0 {
+		return nil, ErrEmptyValue
+	}
+	val, ok := new(big.Float).SetPrec(bigFloatPrecision).SetString(string(n))
+	if !ok {
+		return nil, errors.Errorf("invalid number %q", n)
+	}
+	return val, nil
+}
+
+// BigRat parses n as an exact rational number.
+// It returns ErrEmptyValue, if n is empty.
+func BigRat(n json.Number) (*big.Rat, error) {
+	if len(n) == 0 {
+		return nil, ErrEmptyValue
+	}
+	val, ok := new(big.Rat).SetString(string(n))
+	if !ok {
+		return nil, errors.Errorf("invalid number %q", n)
+	}
+	return val, nil
+}
+
+// TotalCapBig returns TotalCap as a big.Float. See BigFloat.
+func (g Global) TotalCapBig() (*big.Float, error) {
+	return namedBigFloat("total cap", g.TotalCap)
+}
+
+// MktcapBig returns Mktcap as a big.Float. See BigFloat.
+func (f Front) MktcapBig() (*big.Float, error) {
+	return namedBigFloat("market cap", f.Mktcap)
+}
+
+// MarketCapBig returns MarketCap as a big.Float. See BigFloat.
+func (p *Page) MarketCapBig() (*big.Float, error) {
+	return namedBigFloat("market cap", p.MarketCap)
+}
+
+// namedBigFloat works like BigFloat, adding the field name to errors.
+func namedBigFloat(name string, n json.Number) (*big.Float, error) {
+	val, err := BigFloat(n)
+	if err != nil {
+		return nil, errors.Wrap(err, name)
+	}
+	return val, nil
+}
+
+// NumberSentinel replaces empty and invalid json.Number values in replies, if enabled with WithNumberNormalization.
+const NumberSentinel = json.Number("0")
+
+var (
+	numberType      = reflect.TypeOf(json.Number(""))
+	unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// normalizeNumbers replaces empty and invalid values of json.Number fields of type t in raw json with NumberSentinel.
+// Values of other fields are left as is.
+func normalizeNumbers(raw []byte, t reflect.Type) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var tree interface{}
+	if err := dec.Decode(&tree); err != nil {
+		return nil, err
+	}
+	if !normalizeValue(&tree, t) {
+		return raw, nil
+	}
+	return json.Marshal(tree)
+}
+
+// normalizeValue normalizes v, which is to be decoded into a value of type t.
+// It returns true, if v or any of its nested values were changed.
+func normalizeValue(v *interface{}, t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		if *v == nil {
+			return false
+		}
+		t = t.Elem()
+	}
+	if t == numberType {
+		switch val := (*v).(type) {
+		case json.Number:
+			return false
+		case string:
+			// the same check encoding/json does for quoted numbers.
+			if json.Unmarshal([]byte(strconv.Quote(val)), new(json.Number)) == nil {
+				return false
+			}
+		case nil:
+		default:
+			return false
+		}
+		*v = NumberSentinel
+		return true
+	}
+	if reflect.PtrTo(t).Implements(unmarshalerType) {
+		return false
+	}
+	changed := false
+	switch t.Kind() {
+	case reflect.Struct:
+		if obj, ok := (*v).(map[string]interface{}); ok {
+			changed = normalizeFields(obj, t)
+		}
+	case reflect.Slice, reflect.Array:
+		if arr, ok := (*v).([]interface{}); ok {
+			for i := range arr {
+				changed = normalizeValue(&arr[i], t.Elem()) || changed
+			}
+		}
+	case reflect.Map:
+		if obj, ok := (*v).(map[string]interface{}); ok {
+			for key, val := range obj {
+				if normalizeValue(&val, t.Elem()) {
+					obj[key], changed = val, true
+				}
+			}
+		}
+	}
+	return changed
+}
+
+// normalizeFields normalizes values of obj, which are to be decoded into fields of struct t.
+// Fields are matched by names the same way encoding/json does.
+func normalizeFields(obj map[string]interface{}, t reflect.Type) bool {
+	changed := false
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if len(field.PkgPath) > 0 && !field.Anonymous {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if len(name) == 0 {
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				changed = normalizeFields(obj, field.Type) || changed
+				continue
+			}
+			name = field.Name
+		}
+		key := name
+		if _, found := obj[key]; !found {
+			for k := range obj {
+				if strings.EqualFold(k, name) {
+					key = k
+					break
+				}
+			}
+		}
+		if val, found := obj[key]; found && normalizeValue(&val, field.Type) {
+			obj[key], changed = val, true
+		}
+	}
+	return changed
+}
@@ -0,0 +1,127 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestFloatOrZero(t *testing.T) {
+	for _, tc := range []struct {
+		n    json.Number
+		want float64
+	}{
+		{n: "", want: 0},
+		{n: "12.5", want: 12.5},
+		{n: "1e3", want: 1000},
+		{n: "abc", want: 0},
+	} {
+		if got := FloatOrZero(tc.n); got != tc.want {
+			t.Errorf("%q: expected %v, got %v", tc.n, tc.want, got)
+		}
+	}
+}
+
+func TestMustFloat(t *testing.T) {
+	if got := MustFloat("12.5"); got != 12.5 {
+		t.Errorf("expected 12.5, got %v", got)
+	}
+	for _, n := range []json.Number{"", "abc"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%q: expected panic", n)
+				}
+			}()
+			MustFloat(n)
+		}()
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+	if val, err := parseNumber("price", "1.5"); err != nil || val != 1.5 {
+		t.Errorf("unexpected result %v, %v", val, err)
+	}
+	if _, err := parseNumber("price", ""); !errors.Is(err, ErrEmptyValue) {
+		t.Errorf("expected ErrEmptyValue, got %v", err)
+	}
+	if _, err := parseNumber("price", "abc"); err == nil || errors.Is(err, ErrEmptyValue) {
+		t.Errorf("expected parse error, got %v", err)
+	}
+}
+
+func TestBigNumbers(t *testing.T) {
+	const large = "123456789012345678901.25"
+	g := Global{TotalCap: large}
+	bf, err := g.TotalCapBig()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got := bf.Text('f', 2); got != large {
+		t.Errorf("expected %s, got %s", large, got)
+	}
+	f := MustFloat(large)
+	if got := new(big.Float).SetFloat64(f).Text('f', 2); got == large {
+		t.Errorf("float64 is expected to lose precision, got %s", got)
+	}
+	r, err := BigRat(large)
+	if err != nil {
+		t.Error(err)
+	} else if got := r.FloatString(2); got != large {
+		t.Errorf("expected %s, got %s", large, got)
+	}
+	if _, err := (Front{}).MktcapBig(); !errors.Is(err, ErrEmptyValue) {
+		t.Errorf("expected ErrEmptyValue, got %v", err)
+	}
+	if _, err := (&Page{MarketCap: "1e2x"}).MarketCapBig(); err == nil || errors.Is(err, ErrEmptyValue) {
+		t.Errorf("expected parse error, got %v", err)
+	}
+}
+
+func TestNumberNormalization(t *testing.T) {
+	const reply = `{"id":"BTC","BTCPrice":"","dom":"n/a","price_usd":"4000.5","market_cap":null,"supply":16500000}`
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(reply))
+	}
+	if _, err := newTestClient(t, handler).Page("BTC"); !errors.Is(err, ErrDecode) {
+		t.Errorf("expected decode error without normalization, got %v", err)
+	}
+	page, err := newTestClient(t, handler, WithNumberNormalization(true)).Page("BTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.BTCPrice != NumberSentinel || page.Dom != NumberSentinel || page.MarketCap != NumberSentinel {
+		t.Errorf("expected empty values to be normalized, got %q, %q, %q", page.BTCPrice, page.Dom, page.MarketCap)
+	}
+	if page.ID != "BTC" || page.PriceUSD != "4000.5" || page.Supply != "16500000" {
+		t.Errorf("valid values must be left as is, got %+v", page)
+	}
+	if len(page.Volume) != 0 {
+		t.Errorf("missing values must be left as is, got %q", page.Volume)
+	}
+}
+
+func TestNumberNormalizationFront(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"short":"BTC","price":"","mktcap":"1e11","vwapData":null},{"short":"ETH","perc":""}]`))
+	}, WithNumberNormalization(true))
+	fronts, err := client.Front()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fronts) != 2 {
+		t.Fatalf("expected 2 fronts, got %d", len(fronts))
+	}
+	if fronts[0].Price != NumberSentinel || fronts[0].Mktcap != "1e11" || fronts[0].VwapData != nil {
+		t.Errorf("unexpected front %+v", fronts[0])
+	}
+	if fronts[1].Perc != NumberSentinel || MustFloat(fronts[1].Perc) != 0 {
+		t.Errorf("unexpected perc %q", fronts[1].Perc)
+	}
+}
@@ -0,0 +1,369 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/graarh/golang-socketio/transport"
+	"github.com/pkg/errors"
+)
+
+// Option configures a Client.
+type Option func(c *Client)
+
+// WithUserAgent sets the User-Agent header sent with every request.
+// By default, "coincap-go/<version>" is used.
+func WithUserAgent(ua string) Option {
+	return func(c *Client) {
+		c.userAgent = ua
+	}
+}
+
+// WithHTTPClient makes the client use cl for API requests.
+// Websocket subscriptions do not use it.
+func WithHTTPClient(cl *http.Client) Option {
+	return func(c *Client) {
+		c.cl = cl
+	}
+}
+
+// WithTransport makes the client use tr for API requests, e.g. to share a connection pool between several clients:
+//
+//	tr := &http.Transport{MaxIdleConnsPerHost: 16}
+//	c1, c2 := coincap.New(coincap.WithTransport(tr)), coincap.New(coincap.WithTransport(tr))
+//
+// Unlike WithHTTPClient, the timeout set with WithTimeout is still used.
+// Close does not close connections of tr. WithProxy and WithTLSConfig are ignored.
+func WithTransport(tr http.RoundTripper) Option {
+	return func(c *Client) {
+		c.transport = tr
+	}
+}
+
+// WithHeader adds a header, which is sent with every http request, like an API key or a tracing header.
+// It may be used several times, including for the same key, which adds one more value.
+// Headers set by the client itself take precedence: User-Agent (see WithUserAgent), Accept,
+// Accept-Encoding, If-Modified-Since, and X-Request-ID (see WithRequestIDFunc).
+func WithHeader(key, value string) Option {
+	return func(c *Client) {
+		if c.headers == nil {
+			c.headers = make(http.Header)
+		}
+		c.headers.Add(key, value)
+	}
+}
+
+// WithTimeout sets the timeout for API requests. Default is 30 seconds, 0 means no timeout.
+// It does not affect websocket subscriptions, and is ignored,
+// if a client is set with WithHTTPClient: its own Timeout is used instead.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = d
+	}
+}
+
+// WithEndpointTimeout sets the timeout for requests of given path, like "history" or "global", and its subpaths,
+// overriding the one set with WithTimeout, so that slow endpoints may have longer timeouts than fast ones.
+// 0 means no timeout. It may be used several times, the longest matching path wins, query parameters are ignored.
+// GetRaw uses the longest of all the timeouts. If a client is set with WithHTTPClient, its own Timeout still applies.
+func WithEndpointTimeout(path string, d time.Duration) Option {
+	return func(c *Client) {
+		if c.endpointTimeouts == nil {
+			c.endpointTimeouts = make(map[string]time.Duration)
+		}
+		c.endpointTimeouts[strings.Trim(path, "/")] = d
+	}
+}
+
+// WithObserver sets a function, which is called after every API request with the request path,
+// its duration and the resulting error, if any. It may be used to collect metrics or for logging.
+func WithObserver(fn func(path string, duration time.Duration, err error)) Option {
+	return func(c *Client) {
+		c.observer = fn
+	}
+}
+
+// WithRequestObserver works like WithObserver, but fn receives RequestInfo, which also contains the request ID,
+// so that successful requests may be correlated as well. It may be used together with WithObserver.
+func WithRequestObserver(fn func(info RequestInfo)) Option {
+	return func(c *Client) {
+		c.requestObserver = fn
+	}
+}
+
+// WithRequestIDFunc makes the client send an X-Request-ID header with an ID generated by fn for every http request.
+// Errors of such requests are wrapped with RequestIDError, so the ID is also passed to the observer.
+// The observer set with WithRequestObserver receives the ID of successful requests too.
+// Replies served from the cache have no ID.
+func WithRequestIDFunc(fn func() string) Option {
+	return func(c *Client) {
+		c.requestIDFunc = fn
+	}
+}
+
+// WithMetrics makes the client report requests and websocket events to m.
+// Unlike WithObserver, it also reports websocket messages and reconnects.
+func WithMetrics(m Metrics) Option {
+	return func(c *Client) {
+		c.metrics = m
+	}
+}
+
+// WithLogger sets a logger for websocket subscription events,
+// such as connects, disconnects and errors. By default, nothing is logged.
+func WithLogger(l Logger) Option {
+	return func(c *Client) {
+		c.logger = l
+	}
+}
+
+// WithProxy makes API requests go through the given proxy.
+// http, https and socks5 proxy URLs are supported.
+// If the URL is invalid, all requests will fail with the parse error.
+// It is ignored, if a client is set with WithHTTPClient.
+// Websocket subscriptions do not use the proxy, as the socket.io transport can't be configured for that.
+func WithProxy(proxyURL string) Option {
+	return func(c *Client) {
+		u, err := url.Parse(proxyURL)
+		if err != nil {
+			c.err = errors.Wrap(err, "invalid proxy url")
+			return
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			c.err = errors.Errorf("unsupported proxy scheme %q", u.Scheme)
+			return
+		}
+		if len(u.Host) == 0 {
+			c.err = errors.Errorf("empty proxy host in %q", proxyURL)
+			return
+		}
+		c.proxy = u
+	}
+}
+
+// WithTLSConfig sets TLS configuration for API requests.
+// It may be used for certificate pinning or to trust a custom CA.
+// It is ignored, if a client is set with WithHTTPClient, as its transport is used as is.
+// Websocket subscriptions always use the default TLS configuration.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(c *Client) {
+		c.tlsConfig = cfg
+	}
+}
+
+// WithWebsocketTransport sets the socket.io transport for websocket subscriptions.
+// It may be used to tune ping intervals, timeouts and buffer sizes.
+// By default, transport.GetDefaultWebsocketTransport() is used for every connection.
+func WithWebsocketTransport(tr *transport.WebsocketTransport) Option {
+	return func(c *Client) {
+		if tr != nil {
+			c.wsTransport = tr
+		}
+	}
+}
+
+// WithInsecureSkipVerify disables verification of server certificates for API requests.
+// It must be used only in tests, e.g. with httptest.NewTLSServer, as it makes connections vulnerable
+// to man-in-the-middle attacks. Default is false. A config set with WithTLSConfig is not modified.
+// It is ignored, if a client is set with WithHTTPClient.
+func WithInsecureSkipVerify(skip bool) Option {
+	return func(c *Client) {
+		c.insecureSkipVerify = skip
+	}
+}
+
+// WithRetryBudget enables retries of requests, which failed with network errors, 5xx or 429 statuses.
+// A request is retried up to 3 times with exponential backoff starting at 100ms, see WithBackoff.
+// Delays requested by coincap in Retry-After header of 429 replies are honored, see WithMaxRetryAfter.
+// The budget is shared by all the requests of the client, including the parallel ones made by batch methods:
+// it allows max retries at once, and is refilled with max retries per window,
+// so a partial outage does not multiply the load on coincap.
+// By default, requests are not retried.
+func WithRetryBudget(max int, window time.Duration) Option {
+	return func(c *Client) {
+		c.retryBudget = newRetryBudget(max, window)
+	}
+}
+
+// WithMaxRetryAfter sets the max delay before a retry of a 429 reply, requested by coincap via Retry-After header.
+// Longer delays are shortened to d. Retries are enabled with WithRetryBudget. Default is 30s.
+func WithMaxRetryAfter(d time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetryAfter = d
+	}
+}
+
+// WithReconnectHook sets a function, which is called before every reconnect of a subscription,
+// either automatic or requested via stopChan, e.g. to re-authenticate or to update the client configuration.
+// If fn returns an error, the subscription terminates with it.
+// ctx is canceled, if the subscription is stopped, or the client is closed, while fn is running;
+// the subscription does not wait for fn to return then.
+func WithReconnectHook(fn func(ctx context.Context) error) Option {
+	return func(c *Client) {
+		c.reconnectHook = fn
+	}
+}
+
+// WithBackoff sets delays between retries of failed requests (see WithRetryBudget) and automatic websocket reconnects.
+// By default, retries use ExponentialBackoff starting at 100ms, and subscriptions reconnect immediately.
+// If a reconnect fails to dial, subscriptions with an error channel (see SubscribeTradesWithErrors) retry it,
+// by default with ExponentialBackoff starting at 100ms up to 30s, while others return the dial error.
+// Reconnects requested via stopChan are never delayed, unlike the retries of their failed dials.
+func WithBackoff(b Backoff) Option {
+	return func(c *Client) {
+		c.backoff = b
+	}
+}
+
+// WithBatchConcurrency sets the max number of parallel requests made by batch methods, like Pages.
+// Default is 4. Values less than 1 are treated as 1.
+func WithBatchConcurrency(n int) Option {
+	return func(c *Client) {
+		if n < 1 {
+			n = 1
+		}
+		c.batchConcurrency = n
+	}
+}
+
+// WithMaxConcurrency limits the number of simultaneous http requests made by the client to n,
+// including the requests of batch methods. Requests wait for a free slot, until their context is done.
+// Replies served from the cache and GetRaw requests are not limited. By default, there is no limit.
+// Values less than 1 are treated as 1.
+func WithMaxConcurrency(n int) Option {
+	return func(c *Client) {
+		if n < 1 {
+			n = 1
+		}
+		c.inFlight = make(chan struct{}, n)
+	}
+}
+
+// WithStallTimeout makes websocket subscriptions reconnect automatically,
+// if no messages were received during d. By default, subscriptions never reconnect by themselves.
+func WithStallTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.stallTimeout = d
+	}
+}
+
+// WithDialTimeout sets the timeout for establishing websocket connections. Default is 10 seconds, 0 means no timeout.
+// If the initial connection can't be established in time, the subscription fails with an error.
+// Timed out reconnects are handled like other failed dials: with an error channel they are retried,
+// otherwise the subscription returns the timeout error, see WithBackoff.
+func WithDialTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.dialTimeout = d
+	}
+}
+
+// WithCache enables in-memory caching of API replies for the duration of ttl.
+// Replies for the excluded paths (e.g. "front" or "/front") and their subpaths are never cached.
+// If a reply has Last-Modified header, it is revalidated after expiry with If-Modified-Since header,
+// and reused, if coincap replies with 304 Not Modified.
+func WithCache(ttl time.Duration, exclude ...string) Option {
+	return func(c *Client) {
+		c.cache = newCache(ttl, exclude)
+	}
+}
+
+// WithDropPolicy sets the policy for subscription messages, that can't be delivered immediately.
+// Default is DropPolicyBlock. See also WithSendTimeout.
+func WithDropPolicy(policy DropPolicy) Option {
+	return func(c *Client) {
+		c.dropPolicy = policy
+	}
+}
+
+// WithSendTimeout limits the time a subscription waits for the consumer to receive a message from its data channel,
+// so that a stalled consumer does not block the websocket read loop indefinitely.
+// What happens after the timeout depends on the drop policy: with DropPolicyBlock the message is dropped,
+// and counted in SubscriptionStats.Dropped, with DropPolicyFail the subscription terminates with ErrSendTimeout.
+// DropPolicyDrop never waits. Default is 0, which means no timeout.
+func WithSendTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.sendTimeout = d
+	}
+}
+
+// WithGracefulStop makes subscriptions deliver messages, that were already received, after a stop signal is sent
+// to stopChan. The websocket connection is closed immediately, and the subscription returns as soon as
+// all pending messages are delivered, but not later than timeout.
+// Default is 0: pending messages are dropped on stop.
+func WithGracefulStop(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.drainTimeout = timeout
+	}
+}
+
+// WithConnStateHandler sets a function, which is called on every state change of websocket subscriptions.
+// The function is called in a separate goroutine, so it never blocks subscriptions,
+// and states of a subscription are passed to it in order. It may be used to show connection status in UI.
+func WithConnStateHandler(fn func(state ConnState)) Option {
+	return func(c *Client) {
+		c.connStateHandler = fn
+	}
+}
+
+// WithSkewWarning makes trade subscriptions log a warning, if the time skew of a trade exceeds d in either direction.
+// It helps to detect wrong local clocks and stale streams. See Trade.Skew. Default is 0, which disables warnings.
+func WithSkewWarning(d time.Duration) Option {
+	return func(c *Client) {
+		c.maxSkew = d
+	}
+}
+
+// WithTradeDedup makes trade subscriptions suppress duplicate trades with the same market and raw id.
+// Each subscription remembers the last 'size' trades, so a duplicate is detected,
+// if it arrives within 'size' trades after the original. Suppressed trades are counted in SubscriptionStats.Duplicates.
+// Default is 0, which disables deduplication.
+func WithTradeDedup(size int) Option {
+	return func(c *Client) {
+		c.dedupSize = size
+	}
+}
+
+// WithStrictDecoding makes the client fail requests, if a reply contains fields unknown to the library.
+// It helps to detect changes of coincap API. Default is false, unknown fields are ignored.
+func WithStrictDecoding(strict bool) Option {
+	return func(c *Client) {
+		c.strictDecoding = strict
+	}
+}
+
+// WithNumberNormalization makes the client replace empty and invalid values of json.Number fields
+// in replies, like "" or "n/a", with NumberSentinel, so that their conversion to float does not fail.
+// Without it such values make the whole request fail with ErrDecode.
+// Missing fields and nulls for *json.Number fields are left as is.
+// Default is false, use it only if zeros are acceptable in place of unknown values.
+func WithNumberNormalization(enabled bool) Option {
+	return func(c *Client) {
+		c.normalizeNumbers = enabled
+	}
+}
+
+// WithDecoder makes the client use d instead of encoding/json to decode replies and websocket messages,
+// e.g. to plug in a faster json library. If strict decoding is enabled, encoding/json is used for replies anyway.
+// Default is encoding/json with UseNumber. nil restores the default.
+func WithDecoder(d Decoder) Option {
+	return func(c *Client) {
+		c.decoder = d
+	}
+}
+
+// WithSymbolNormalization sets, whether symbols passed to Page and History are trimmed and uppercased.
+// Default is true, as coincap symbols are uppercase, and lowercase ones are not found.
+// Normalized symbols are also checked with ValidSymbol, while raw ones are only escaped.
+func WithSymbolNormalization(enabled bool) Option {
+	return func(c *Client) {
+		c.rawSymbols = !enabled
+	}
+}
@@ -0,0 +1,286 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestUserAgent(t *testing.T) {
+	for _, tc := range []struct {
+		opts []Option
+		want string
+	}{
+		{want: defaultUserAgent},
+		{opts: []Option{WithUserAgent("my-app/1.0")}, want: "my-app/1.0"},
+	} {
+		var got string
+		client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			got = r.Header.Get("User-Agent")
+			w.Write([]byte(`["BTC"]`))
+		}, tc.opts...)
+		if _, err := client.Coins(); err != nil {
+			t.Error(err)
+		} else if got != tc.want {
+			t.Errorf("expected User-Agent %q, got %q", tc.want, got)
+		}
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	var got http.Header
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		w.Write([]byte(`["BTC"]`))
+	}, WithHeader("X-Api-Key", "secret"), WithHeader("X-Trace", "a"), WithHeader("x-trace", "b"),
+		WithHeader("User-Agent", "ignored"), WithUserAgent("my-app/1.0"))
+	for i := 0; i < 2; i++ {
+		if _, err := client.Coins(); err != nil {
+			t.Fatal(err)
+		}
+		if key := got.Get("X-Api-Key"); key != "secret" {
+			t.Errorf("expected api key header, got %q", key)
+		}
+		if trace := got["X-Trace"]; len(trace) != 2 || trace[0] != "a" || trace[1] != "b" {
+			t.Errorf("expected 2 trace headers, got %v", trace)
+		}
+		if ua := got["User-Agent"]; len(ua) != 1 || ua[0] != "my-app/1.0" {
+			t.Errorf("internal headers must take precedence, got %v", ua)
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second * 5):
+		}
+	}, WithTimeout(time.Millisecond*100))
+	start := time.Now()
+	if _, err := client.Global(); err == nil {
+		t.Error("expected timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second*2 {
+		t.Errorf("request did not time out, took %v", elapsed)
+	}
+}
+
+func TestEndpointTimeout(t *testing.T) {
+	// every reply takes 300ms.
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(time.Millisecond * 300):
+		}
+		w.Write([]byte(`{}`))
+	}, WithTimeout(time.Millisecond*100), WithEndpointTimeout("/history/", time.Second*2),
+		WithEndpointTimeout("history/1day", time.Millisecond*50))
+	if timeout := client.cl.Timeout; timeout != time.Second*2 {
+		t.Errorf("expected client timeout to be the longest one, got %v", timeout)
+	}
+	for _, tc := range []struct {
+		name    string
+		call    func() error
+		timeout bool
+	}{
+		{name: "global", call: func() error { _, err := client.Global(); return err }, timeout: true},
+		{name: "history", call: func() error { _, err := client.History("BTC", HistoryInterval7Days); return err }},
+		{name: "history/1day", call: func() error { _, err := client.History("BTC", HistoryInterval1Day); return err }, timeout: true},
+	} {
+		start := time.Now()
+		err := tc.call()
+		elapsed := time.Since(start)
+		if tc.timeout {
+			if err == nil || elapsed > time.Millisecond*250 {
+				t.Errorf("%s: expected a timeout, got %v after %v", tc.name, err, elapsed)
+			}
+		} else if err != nil {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		}
+	}
+	if d := client.requestTimeout("history/1day/BTC?x=1"); d != time.Millisecond*50 {
+		t.Errorf("unexpected timeout %v", d)
+	}
+	if d := client.requestTimeout("historyx"); d != time.Millisecond*100 {
+		t.Errorf("unexpected timeout %v", d)
+	}
+}
+
+func TestHTTPClient(t *testing.T) {
+	cl := &http.Client{}
+	client := New(WithHTTPClient(cl), WithTimeout(time.Second))
+	if client.cl != cl {
+		t.Error("custom http client is not used")
+	}
+	if cl.Timeout != 0 {
+		t.Error("custom http client must not be modified")
+	}
+	if New().cl.Timeout != defaultTimeout {
+		t.Error("default timeout is not set")
+	}
+}
+
+func TestObserver(t *testing.T) {
+	type call struct {
+		path string
+		err  error
+	}
+	var calls []call
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/global" {
+			w.Write([]byte(`{"BTCPrice":1}`))
+		} else {
+			w.Write([]byte(`garbage`))
+		}
+	}, WithObserver(func(path string, duration time.Duration, err error) {
+		if duration <= 0 {
+			t.Errorf("unexpected duration %v", duration)
+		}
+		calls = append(calls, call{path: path, err: err})
+	}))
+	client.Global()
+	client.Coins()
+	if len(calls) != 2 {
+		t.Errorf("expected 2 calls, got %d", len(calls))
+		return
+	}
+	if calls[0].path != "global" || calls[0].err != nil {
+		t.Errorf("unexpected call %v", calls[0])
+	}
+	if calls[1].path != "coins" || calls[1].err == nil {
+		t.Errorf("unexpected call %v", calls[1])
+	}
+}
+
+func TestSharedTransport(t *testing.T) {
+	var conns int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`["BTC"]`))
+	}))
+	srv.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+	tr := &http.Transport{}
+	defer tr.CloseIdleConnections()
+	clients := []*Client{New(WithTransport(tr)), New(WithTransport(tr))}
+	for _, client := range clients {
+		client.apiURL = srv.URL + "/"
+		if _, err := client.Coins(); err != nil {
+			t.Error(err)
+		}
+	}
+	clients[0].Close()
+	if _, err := clients[1].Coins(); err != nil {
+		t.Error(err)
+	}
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Errorf("expected 1 shared connection, got %d", n)
+	}
+	if clients[1].cl.Timeout != defaultTimeout {
+		t.Error("default timeout is not set")
+	}
+}
+
+func TestProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.Write([]byte(`["BTC"]`))
+	}))
+	defer proxy.Close()
+	client := New(WithProxy(proxy.URL))
+	client.apiURL = "http://coincap.test/"
+	if _, err := client.Coins(); err != nil {
+		t.Error(err)
+	} else if proxied != "http://coincap.test/coins" {
+		t.Errorf("request was not proxied, got %q", proxied)
+	}
+}
+
+func TestProxyInvalid(t *testing.T) {
+	for _, proxyURL := range []string{"://bad", "ftp://proxy:21", "http://"} {
+		client := New(WithProxy(proxyURL))
+		if _, err := client.Coins(); err == nil {
+			t.Errorf("expected an error for %q", proxyURL)
+		}
+		if err := client.SubscribeTrades(make(chan *Trade), make(chan bool)); err == nil {
+			t.Errorf("expected an error for %q", proxyURL)
+		}
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`["BTC"]`))
+	}))
+	defer srv.Close()
+	client := New()
+	client.apiURL = srv.URL + "/"
+	if _, err := client.Coins(); err == nil {
+		t.Error("expected certificate error")
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	client = New(WithTLSConfig(&tls.Config{RootCAs: pool}))
+	client.apiURL = srv.URL + "/"
+	if _, err := client.Coins(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestInsecureSkipVerify(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`["BTC"]`))
+	}))
+	defer srv.Close()
+	for _, skip := range []bool{false, true} {
+		client := New(WithInsecureSkipVerify(skip))
+		client.apiURL = srv.URL + "/"
+		if _, err := client.Coins(); skip && err != nil {
+			t.Error(err)
+		} else if !skip && err == nil {
+			t.Error("expected certificate error")
+		}
+	}
+	cfg := &tls.Config{ServerName: "coincap.test"}
+	tr := New(WithTLSConfig(cfg), WithInsecureSkipVerify(true)).cl.Transport.(*http.Transport)
+	if !tr.TLSClientConfig.InsecureSkipVerify || tr.TLSClientConfig.ServerName != "coincap.test" || cfg.InsecureSkipVerify {
+		t.Error("custom tls config is not applied correctly")
+	}
+}
+
+func TestStrictDecoding(t *testing.T) {
+	const reply = `{"altCap":1,"bitnodesCount":2,"newField":3}`
+	for _, tc := range []struct {
+		opts    []Option
+		wantErr bool
+	}{
+		{},
+		{opts: []Option{WithStrictDecoding(false)}},
+		{opts: []Option{WithStrictDecoding(true)}, wantErr: true},
+	} {
+		client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(reply))
+		}, tc.opts...)
+		_, err := client.Global()
+		if tc.wantErr && (err == nil || !strings.Contains(err.Error(), "newField")) {
+			t.Errorf("expected unknown field error, got %v", err)
+		} else if !tc.wantErr && err != nil {
+			t.Error(err)
+		}
+	}
+}
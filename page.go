@@ -0,0 +1,259 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrCurrencyUnavailable is returned, if a price in requested currency is unknown or empty.
+var ErrCurrencyUnavailable = errors.New("currency unavailable")
+
+// PageRaw works like Page, but also returns the reply body, from which the page was decoded,
+// e.g. to inspect it, if the page looks wrong. The body is the json value exactly as received
+// from coincap (after decompression), without surrounding whitespace. It is read only once,
+// and comes from the cache, if the page does.
+func (c *Client) PageRaw(ctx context.Context, symb string) (*Page, []byte, error) {
+	name, err := c.symbolPath(symb)
+	if err != nil {
+		return nil, nil, err
+	}
+	var result Page
+	res, err := c.getRaw(ctx, "page/"+name, &result)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &result, append([]byte(nil), res.data...), nil
+}
+
+// ErrPartial is returned by PageWithTimeout together with a partially decoded page.
+var ErrPartial = errors.New("partial reply")
+
+// partialError matches ErrPartial, and keeps the cause of the partial reply accessible via errors.Is and errors.As.
+type partialError struct {
+	cause error
+}
+
+func (e *partialError) Error() string {
+	return ErrPartial.Error() + ": " + e.cause.Error()
+}
+
+func (e *partialError) Unwrap() error {
+	return e.cause
+}
+
+// Cause makes partialError compatible with errors.Cause.
+func (e *partialError) Cause() error {
+	return e.cause
+}
+
+func (e *partialError) Is(target error) bool {
+	return target == ErrPartial
+}
+
+// PageWithTimeout works like Page, but if ctx is done, or the request times out, while the reply is being read,
+// it returns the fields read so far together with an error, which matches both ErrPartial and ErrNetwork,
+// and wraps the cause, e.g. context.DeadlineExceeded.
+// This is best-effort: only top-level fields, which were read completely, are decoded,
+// so any other field may be empty. If no fields were read, the page is nil, and the error is ErrNetwork.
+// The reply is neither cached nor taken from the cache, and the request is not retried.
+func (c *Client) PageWithTimeout(ctx context.Context, symb string) (page *Page, err error) {
+	name, err := c.symbolPath(symb)
+	if err != nil {
+		return nil, err
+	}
+	path := "page/" + name
+	var id string
+	defer c.observe(path, &id, time.Now(), &err)
+	if err := c.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer c.release()
+	ctx, cancel := c.withRequestTimeout(ctx, path)
+	defer cancel()
+	id = c.newRequestID()
+	req, err := c.newRequest(ctx, path, id)
+	if err != nil {
+		return nil, withRequestID(err, id)
+	}
+	resp, err := c.cl.Do(req)
+	if err != nil {
+		return nil, withRequestID(withClass(ErrNetwork, errors.Wrap(err, "http request error")), id)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, withRequestID(newHTTPStatusError(resp), id)
+	}
+	if err := checkContentType(resp.Header.Get("Content-Type"), resp.Body); err != nil {
+		return nil, withRequestID(err, id)
+	}
+	fields, readErr := readFields(resp.Body)
+	// the reply is partial, if ctx is done, or the timeout of the http client fires, while reading the body.
+	partial := readErr != nil && (ctx.Err() != nil || isTimeout(readErr))
+	if readErr != nil {
+		if !partial {
+			if readErr != ErrEmptyResponse {
+				readErr = withClass(ErrDecode, errors.Wrap(readErr, "failed to decode request"))
+			}
+			return nil, withRequestID(readErr, id)
+		}
+		if len(fields) == 0 {
+			return nil, withRequestID(withClass(ErrNetwork, errors.Wrap(readErr, "failed to read reply")), id)
+		}
+	}
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return nil, withRequestID(withClass(ErrDecode, errors.Wrap(err, "failed to decode request")), id)
+	}
+	var result Page
+	if err := unmarshal(raw, &result, c.decodeOptions()); err != nil {
+		return nil, withRequestID(err, id)
+	}
+	if partial {
+		cause := ctx.Err()
+		if cause == nil {
+			cause = readErr
+		}
+		cause = withClass(ErrNetwork, errors.Wrap(cause, "failed to read reply"))
+		return &result, withRequestID(&partialError{cause: cause}, id)
+	}
+	return &result, nil
+}
+
+// readFields reads a json object from r field by field.
+// On error, it returns the fields, which were read completely.
+func readFields(r io.Reader) (map[string]json.RawMessage, error) {
+	fields := make(map[string]json.RawMessage)
+	dec := json.NewDecoder(r)
+	tok, err := dec.Token()
+	if err != nil {
+		if err == io.EOF {
+			return nil, ErrEmptyResponse
+		}
+		return nil, err
+	}
+	if tok != json.Delim('{') {
+		return nil, errors.Errorf("expected an object, got %v", tok)
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return fields, err
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return fields, err
+		}
+		fields[tok.(string)] = value
+	}
+	if _, err := dec.Token(); err != nil {
+		return fields, err
+	}
+	return fields, nil
+}
+
+type pagePrice struct {
+	currency string
+	price    json.Number
+}
+
+func (p *Page) prices() []pagePrice {
+	return []pagePrice{
+		{"USD", p.PriceUSD},
+		{"EUR", p.PriceEUR},
+		{"BTC", p.PriceBTC},
+		{"ETH", p.PriceETH},
+		{"ZEC", p.PriceZEC},
+		{"LTC", p.PriceLTC},
+	}
+}
+
+// Prices returns page prices keyed by currency code: "USD", "EUR", "BTC", "ETH", "ZEC", "LTC".
+// Empty prices are omitted.
+func (p *Page) Prices() (map[string]float64, error) {
+	result := make(map[string]float64)
+	for _, pp := range p.prices() {
+		if len(pp.price) == 0 {
+			continue
+		}
+		val, err := pp.price.Float64()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s price", pp.currency)
+		}
+		result[pp.currency] = val
+	}
+	return result, nil
+}
+
+// PriceIn returns the price in given currency (case-insensitive),
+// which is one of "USD", "EUR", "BTC", "ETH", "ZEC", "LTC".
+// If the currency is unknown or its price is empty, ErrCurrencyUnavailable is returned.
+func (p *Page) PriceIn(currency string) (float64, error) {
+	currency = strings.ToUpper(currency)
+	for _, pp := range p.prices() {
+		if pp.currency != currency {
+			continue
+		}
+		if len(pp.price) == 0 {
+			break
+		}
+		val, err := pp.price.Float64()
+		if err != nil {
+			return 0, errors.Wrapf(err, "failed to parse %s price", pp.currency)
+		}
+		return val, nil
+	}
+	return 0, errors.Wrap(ErrCurrencyUnavailable, currency)
+}
+
+// Cap24hChangePercent returns the 24 hour change of the market cap in whole percents, e.g. -1.5 for -1.5%,
+// which is Cap24hChange field. It differs from the price change, if the supply changed during the day.
+// If the field is empty, an error wrapping ErrEmptyValue is returned.
+// See Client.Change24hPercent for the price change.
+func (p *Page) Cap24hChangePercent() (float64, error) {
+	return parseNumber("24h change", p.Cap24hChange)
+}
+
+// Change24hPercent returns the 24 hour price change of given symbol in whole percents.
+// It requests 1 day history of the symbol, and uses History.PriceChangePercent. If the history has
+// less than 2 prices, it requests the page of the symbol, and uses Page.Cap24hChangePercent instead,
+// which is the change of the market cap, and approximates the price change, while the supply is constant.
+// If both are unavailable, an error wrapping ErrEmptyValue is returned.
+func (c *Client) Change24hPercent(ctx context.Context, symb string) (float64, error) {
+	hist, err := c.symbolHistory(ctx, symb, HistoryInterval1Day)
+	if err != nil {
+		return 0, err
+	}
+	change, err := hist.PriceChangePercent()
+	if !errors.Is(err, ErrEmptyValue) {
+		return change, err
+	}
+	page, err := c.page(ctx, symb)
+	if err != nil {
+		return 0, err
+	}
+	return page.Cap24hChangePercent()
+}
+
+// PriceDeviationFromVWAP returns the difference between Price and VWAP24h in percents of VWAP24h.
+// A positive value means, that the price is above the average.
+func (p *Page) PriceDeviationFromVWAP() (float64, error) {
+	price, err := parseNumber("price", p.Price)
+	if err != nil {
+		return 0, err
+	}
+	vwap, err := parseNumber("vwap", p.VWAP24h)
+	if err != nil {
+		return 0, err
+	}
+	if vwap == 0 {
+		return 0, errors.New("zero vwap")
+	}
+	return (price - vwap) / vwap * 100, nil
+}
@@ -0,0 +1,224 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestPagePrices(t *testing.T) {
+	page := Page{PriceUSD: "4000.5", PriceBTC: "1", PriceETH: "13.25"}
+	prices, err := page.Prices()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := map[string]float64{"USD": 4000.5, "BTC": 1, "ETH": 13.25}
+	if len(prices) != len(expected) {
+		t.Errorf("expected %v, got %v", expected, prices)
+	}
+	for cur, val := range expected {
+		if prices[cur] != val {
+			t.Errorf("expected %s price %v, got %v", cur, val, prices[cur])
+		}
+	}
+	page.PriceEUR = "bad"
+	if _, err := page.Prices(); err == nil {
+		t.Error("expected parse error")
+	}
+}
+
+func TestPagePriceIn(t *testing.T) {
+	page := Page{PriceUSD: "4000.5", PriceLTC: "70"}
+	for _, tc := range []struct {
+		currency string
+		want     float64
+		err      error
+	}{
+		{currency: "USD", want: 4000.5},
+		{currency: "usd", want: 4000.5},
+		{currency: "Ltc", want: 70},
+		{currency: "EUR", err: ErrCurrencyUnavailable},
+		{currency: "XYZ", err: ErrCurrencyUnavailable},
+	} {
+		val, err := page.PriceIn(tc.currency)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s: expected error %v, got %v", tc.currency, tc.err, err)
+		} else if val != tc.want {
+			t.Errorf("%s: expected %v, got %v", tc.currency, tc.want, val)
+		}
+	}
+}
+
+func TestPagePriceDeviationFromVWAP(t *testing.T) {
+	page := Page{Price: "4330.16", VWAP24h: "4352.08"}
+	if val, err := page.PriceDeviationFromVWAP(); err != nil {
+		t.Error(err)
+	} else if math.Abs(val-(-0.50366)) > 1e-5 {
+		t.Errorf("unexpected deviation %v", val)
+	}
+	page = Page{Price: "110", VWAP24h: "100"}
+	if val, err := page.PriceDeviationFromVWAP(); err != nil {
+		t.Error(err)
+	} else if math.Abs(val-10) > 1e-9 {
+		t.Errorf("unexpected deviation %v", val)
+	}
+	page.VWAP24h = "0"
+	if _, err := page.PriceDeviationFromVWAP(); err == nil {
+		t.Error("expected an error for zero vwap")
+	}
+	page.VWAP24h = ""
+	if _, err := page.PriceDeviationFromVWAP(); !errors.Is(err, ErrEmptyValue) {
+		t.Errorf("expected ErrEmptyValue, got %v", err)
+	}
+}
+
+func TestPageWithTimeout(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/page/ETH" {
+			w.Write([]byte(`{"id":"ETH","price_usd":300}`))
+			return
+		}
+		if r.URL.Path == "/page/BTC" {
+			w.Write([]byte(`{"id":"BTC","price_usd":4000,"supply":`))
+		}
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second * 5):
+		}
+	}
+	client := newTestClient(t, handler)
+	page, err := client.PageWithTimeout(context.Background(), "ETH")
+	if err != nil {
+		t.Error(err)
+	} else if page.ID != "ETH" || page.PriceUSD != "300" {
+		t.Errorf("unexpected page %+v", page)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	page, err = client.PageWithTimeout(ctx, "BTC")
+	if !errors.Is(err, ErrPartial) {
+		t.Errorf("expected partial error, got %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, ErrNetwork) {
+		t.Errorf("expected the cause of the partial error, got %v", err)
+	}
+	if page == nil || page.ID != "BTC" || page.PriceUSD != "4000" || len(page.Supply) != 0 {
+		t.Errorf("unexpected partial page %+v", page)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	page, err = client.PageWithTimeout(ctx, "LTC")
+	if !errors.Is(err, ErrNetwork) || errors.Is(err, ErrPartial) {
+		t.Errorf("expected network error, got %v", err)
+	}
+	if page != nil {
+		t.Errorf("expected no page, got %+v", page)
+	}
+	// the timeout of the http client fires while reading the body.
+	timeoutClient := newTestClient(t, handler, WithTimeout(time.Millisecond*100))
+	page, err = timeoutClient.PageWithTimeout(context.Background(), "BTC")
+	if !errors.Is(err, ErrPartial) {
+		t.Errorf("expected partial error on client timeout, got %v", err)
+	}
+	if page == nil || page.ID != "BTC" || page.PriceUSD != "4000" {
+		t.Errorf("unexpected partial page %+v", page)
+	}
+	// the request waits for a free slot.
+	limitedClient := newTestClient(t, handler, WithMaxConcurrency(1))
+	holdCtx, holdCancel := context.WithCancel(context.Background())
+	defer holdCancel()
+	go limitedClient.PageWithTimeout(holdCtx, "LTC")
+	time.Sleep(time.Millisecond * 50)
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	if _, err := limitedClient.PageWithTimeout(ctx, "ETH"); !errors.Is(err, ErrNetwork) {
+		t.Errorf("expected the request to wait for a slot, got %v", err)
+	}
+}
+
+func TestPageRaw(t *testing.T) {
+	const body = `{"id":"BTC",  "price_usd": "4000.50", "supply":16500000 }`
+	var requests int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte(body + "\n"))
+	}, WithCache(time.Minute))
+	page, raw, err := client.PageRaw(context.Background(), "btc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(raw) != body {
+		t.Errorf("expected raw body %q, got %q", body, raw)
+	}
+	if page.ID != "BTC" || page.PriceUSD != "4000.50" || page.Supply != "16500000" {
+		t.Errorf("unexpected page %+v", page)
+	}
+	raw[0] = 'x' // must not affect the cache.
+	if _, raw, err = client.PageRaw(context.Background(), "BTC"); err != nil {
+		t.Error(err)
+	} else if string(raw) != body {
+		t.Errorf("expected cached raw body %q, got %q", body, raw)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("expected 1 request, got %d", n)
+	}
+}
+
+func TestChange24hPercent(t *testing.T) {
+	page := Page{Cap24hChange: "-1.12"}
+	if val, err := page.Cap24hChangePercent(); err != nil {
+		t.Error(err)
+	} else if val != -1.12 {
+		t.Errorf("unexpected change %v", val)
+	}
+	page.Cap24hChange = ""
+	if _, err := page.Cap24hChangePercent(); !errors.Is(err, ErrEmptyValue) {
+		t.Errorf("expected ErrEmptyValue, got %v", err)
+	}
+	var pageRequests int32
+	pageBTC, historyBTC := serveFile(t, "page_btc.json"), serveFile(t, "history_btc_1day.json")
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/history/1day/BTC":
+			historyBTC(w, r)
+		case "/history/1day/ETH", "/history/1day/LTC":
+			w.Write([]byte(`{"price":[[1505260800000,70]]}`))
+		case "/page/BTC", "/page/ETH":
+			atomic.AddInt32(&pageRequests, 1)
+			pageBTC(w, r)
+		case "/page/LTC":
+			w.Write([]byte(`{"id":"LTC","price_usd":70}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	if val, err := client.Change24hPercent(context.Background(), "BTC"); err != nil {
+		t.Error(err)
+	} else if math.Abs(val-(-0.58058)) > 1e-5 {
+		t.Errorf("unexpected change %v", val)
+	}
+	if atomic.LoadInt32(&pageRequests) != 0 {
+		t.Error("unexpected page request")
+	}
+	// the market cap change is used, if there is no price history.
+	if val, err := client.Change24hPercent(context.Background(), "ETH"); err != nil {
+		t.Error(err)
+	} else if val != -1.12 {
+		t.Errorf("unexpected change %v", val)
+	}
+	if atomic.LoadInt32(&pageRequests) != 1 {
+		t.Error("expected a page request")
+	}
+	if _, err := client.Change24hPercent(context.Background(), "LTC"); !errors.Is(err, ErrEmptyValue) {
+		t.Errorf("expected ErrEmptyValue, got %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// recordedTrade is a line of a trades recording.
+type recordedTrade struct {
+	// Time is the capture time of the trade.
+	Time  time.Time `json:"time"`
+	Trade *Trade    `json:"trade"`
+}
+
+// ReplayTrades reads recorded trades from r and sends them to dataChan in order.
+// r must contain one json object per line: {"time": "<RFC3339 capture time>", "trade": {<Trade>}}.
+// Empty lines are skipped.
+// If speed is positive, the original intervals between capture times are kept, divided by speed,
+// so 1 replays in real time, and 10 replays ten times faster. Otherwise, trades are sent without delays.
+// It returns after all the trades are sent, or on the first read or decode error.
+func ReplayTrades(r io.Reader, dataChan chan<- *Trade, speed float64) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	var prev time.Time
+	for line := 1; scanner.Scan(); line++ {
+		data := scanner.Bytes()
+		if len(data) == 0 {
+			continue
+		}
+		var rec recordedTrade
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return errors.Wrapf(err, "failed to decode line %d", line)
+		}
+		if rec.Trade == nil {
+			return errors.Errorf("no trade in line %d", line)
+		}
+		if speed > 0 && !prev.IsZero() && rec.Time.After(prev) {
+			time.Sleep(time.Duration(float64(rec.Time.Sub(prev)) / speed))
+		}
+		if !rec.Time.IsZero() {
+			prev = rec.Time
+		}
+		dataChan <- rec.Trade
+	}
+	return errors.Wrap(scanner.Err(), "failed to read trades")
+}
+
+// RecordTrades subscribes for trades and writes them to w in the format read by ReplayTrades,
+// with the capture time of every trade. Writes are buffered, and the buffer is flushed on return.
+// It returns nil, when ctx is done, or an error, if the subscription or a write failed.
+func (c *Client) RecordTrades(ctx context.Context, w io.Writer) error {
+	dataChan, stopChan := make(chan *Trade), make(chan bool)
+	subChan := make(chan error, 1)
+	go func() {
+		subChan <- c.SubscribeTrades(dataChan, stopChan)
+	}()
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	var err error
+	running := true
+	for running && err == nil {
+		select {
+		case trade := <-dataChan:
+			if werr := enc.Encode(recordedTrade{Time: time.Now().UTC(), Trade: trade}); werr != nil {
+				err = errors.Wrap(werr, "failed to write trade")
+			}
+		case err = <-subChan:
+			running = false
+		case <-ctx.Done():
+			close(stopChan)
+			err = <-subChan
+			running = false
+		}
+	}
+	if running {
+		close(stopChan)
+		<-subChan
+	}
+	if ferr := bw.Flush(); ferr != nil && err == nil {
+		err = errors.Wrap(ferr, "failed to flush trades")
+	}
+	return err
+}
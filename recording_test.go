@@ -0,0 +1,96 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	gosio "github.com/graarh/golang-socketio"
+)
+
+const testRecording = `{"time":"2017-09-13T14:12:25Z","trade":{"Msg":{"exchange_id":"bitfinex","market_id":"BTC_USD","Coin":"BTC"},"Data":{"Raw":{"ID":"1"}}}}
+{"time":"2017-09-13T14:12:25.1Z","trade":{"Msg":{"exchange_id":"gdax","market_id":"BTC_USD","Coin":"BTC"},"Data":{"Raw":{"ID":"2"}}}}
+
+{"time":"2017-09-13T14:12:25.2Z","trade":{"Msg":{"exchange_id":"bitfinex","market_id":"ETH_USD","Coin":"ETH"},"Data":{"Raw":{"ID":"3"}}}}
+`
+
+// replay runs ReplayTrades and returns the ids of replayed trades.
+func replay(data string, speed float64) ([]string, error) {
+	dataChan := make(chan *Trade)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- ReplayTrades(strings.NewReader(data), dataChan, speed)
+		close(dataChan)
+	}()
+	var ids []string
+	for trade := range dataChan {
+		ids = append(ids, trade.Data.Raw.ID)
+	}
+	return ids, <-errChan
+}
+
+func TestReplayTrades(t *testing.T) {
+	start := time.Now()
+	ids, err := replay(testRecording, 0)
+	if err != nil {
+		t.Error(err)
+	}
+	if strings.Join(ids, ",") != "1,2,3" {
+		t.Errorf("unexpected trades %v", ids)
+	}
+	if elapsed := time.Since(start); elapsed > time.Millisecond*100 {
+		t.Errorf("replay without delays took %v", elapsed)
+	}
+	start = time.Now()
+	if ids, err = replay(testRecording, 2); err != nil || len(ids) != 3 {
+		t.Errorf("unexpected replay result %v, %v", ids, err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Millisecond*100 || elapsed > time.Millisecond*500 {
+		t.Errorf("replay at 2x speed took %v, expected 100ms", elapsed)
+	}
+	ids, err = replay(testRecording+"garbage\n", 0)
+	if err == nil || !strings.Contains(err.Error(), "line 5") || len(ids) != 3 {
+		t.Errorf("expected decode error after 3 trades, got %v, %v", ids, err)
+	}
+}
+
+func TestRecordTrades(t *testing.T) {
+	client := New()
+	newTestWsServer(t, client, func(ch *gosio.Channel) {
+		emitMessages(ch, "trades",
+			tradeMessage("bitfinex", "BTC_USD", "1", 4000),
+			tradeMessage("gdax", "BTC_USD", "2", 4001),
+			tradeMessage("bitfinex", "ETH_USD", "3", 300),
+		)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*300)
+	defer cancel()
+	start := time.Now()
+	var buf bytes.Buffer
+	if err := client.RecordTrades(ctx, &buf); err != nil {
+		t.Error(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Errorf("expected 3 lines, got %q", buf.String())
+		return
+	}
+	var rec recordedTrade
+	if err := json.Unmarshal([]byte(lines[1]), &rec); err != nil {
+		t.Error(err)
+	} else if rec.Time.Before(start) || rec.Time.After(time.Now()) || rec.Trade.Msg.ExchangeID != "gdax" {
+		t.Errorf("unexpected record %s", lines[1])
+	}
+	ids, err := replay(buf.String(), 0)
+	if err != nil {
+		t.Error(err)
+	}
+	if strings.Join(ids, ",") != "1,2,3" {
+		t.Errorf("unexpected replayed trades %v", ids)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxRetries is the max number of retries of a single request.
+	maxRetries = 3
+	// retryDelay is the delay before the first retry, if no Backoff is set. It is doubled for every next retry.
+	retryDelay = 100 * time.Millisecond
+	// defaultMaxRetryAfter is the default max delay requested by Retry-After header, which is honored.
+	defaultMaxRetryAfter = 30 * time.Second
+)
+
+// retryBudget is a token bucket, which limits the total number of retries of a client.
+// It holds up to max tokens, and is refilled with max tokens per window.
+type retryBudget struct {
+	max    float64
+	window time.Duration
+
+	mut    sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newRetryBudget(max int, window time.Duration) *retryBudget {
+	return &retryBudget{max: float64(max), window: window, tokens: float64(max), last: time.Now()}
+}
+
+// take returns true, if a retry is allowed, consuming a token.
+func (b *retryBudget) take() bool {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	now := time.Now()
+	if b.window > 0 {
+		b.tokens += b.max * float64(now.Sub(b.last)) / float64(b.window)
+		if b.tokens > b.max {
+			b.tokens = b.max
+		}
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// retryable returns true for network errors and http statuses, which may be temporary.
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500 || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+	return errors.Is(err, ErrNetwork)
+}
+
+// nextRetryDelay returns the delay before given attempt, which is the one from Retry-After header of a 429 reply,
+// capped by c.maxRetryAfter, or the one returned by backoff, if there is no header.
+func (c *Client) nextRetryDelay(backoff Backoff, attempt int, err error) time.Duration {
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+		if statusErr.RetryAfter > c.maxRetryAfter {
+			return c.maxRetryAfter
+		}
+		return statusErr.RetryAfter
+	}
+	return backoff.NextDelay(attempt)
+}
+
+// fetchWithRetries works like fetch, but retries failed requests, while the retry budget allows it.
+func (c *Client) fetchWithRetries(ctx context.Context, path, id string, prev *cacheEntry) ([]byte, string, error) {
+	backoff := c.backoff
+	if backoff == nil {
+		backoff = defaultRetryBackoff
+	}
+	for attempt := 0; ; attempt++ {
+		data, lastModified, err := c.fetch(ctx, path, id, prev)
+		if err == nil && attempt > 0 {
+			backoff.Reset()
+		}
+		if err == nil || c.retryBudget == nil || attempt >= maxRetries || !retryable(ctx, err) || !c.retryBudget.take() {
+			return data, lastModified, err
+		}
+		timer := time.NewTimer(c.nextRetryDelay(backoff, attempt+1, err))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, "", err
+		}
+	}
+}
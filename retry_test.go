@@ -0,0 +1,124 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestRetryBudget(t *testing.T) {
+	var requests int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}, WithRetryBudget(4, time.Hour))
+	for i := 0; i < 3; i++ {
+		if _, err := client.Global(); !errors.Is(err, ErrHTTPStatus) {
+			t.Errorf("expected http status error, got %v", err)
+		}
+	}
+	// 3 retries for the first request, 1 for the second, none for the third.
+	if n := atomic.LoadInt32(&requests); n != 7 {
+		t.Errorf("expected 7 requests, got %d", n)
+	}
+}
+
+func TestRetrySuccess(t *testing.T) {
+	var requests int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&requests, 1) {
+		case 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case 2:
+			w.Write([]byte(`{"BTCPrice":4000}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}, WithRetryBudget(10, time.Minute))
+	if gl, err := client.Global(); err != nil {
+		t.Error(err)
+	} else if gl.BTCPrice != "4000" {
+		t.Errorf("unexpected price %q", gl.BTCPrice)
+	}
+	if _, err := client.Global(); !errors.Is(err, ErrHTTPStatus) {
+		t.Errorf("404 must not be retried, got %v", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Errorf("expected 3 requests, got %d", n)
+	}
+}
+
+func TestRetryBudgetRefill(t *testing.T) {
+	b := newRetryBudget(2, time.Millisecond*100)
+	if !b.take() || !b.take() || b.take() {
+		t.Error("expected 2 tokens")
+	}
+	time.Sleep(time.Millisecond * 60)
+	if !b.take() || b.take() {
+		t.Error("expected 1 token after refill")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2017, 11, 5, 10, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		value string
+		want  time.Duration
+	}{
+		{value: "", want: 0},
+		{value: "5", want: time.Second * 5},
+		{value: "-1", want: 0},
+		{value: "soon", want: 0},
+		{value: "Sun, 05 Nov 2017 10:00:30 GMT", want: time.Second * 30},
+		{value: "Sun, 05 Nov 2017 09:59:00 GMT", want: 0},
+	} {
+		if got := parseRetryAfter(tc.value, now); got != tc.want {
+			t.Errorf("%q: expected %v, got %v", tc.value, tc.want, got)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	for name, retryAfter := range map[string]string{
+		"seconds": "3600",
+		"date":    time.Now().Add(time.Hour).UTC().Format(http.TimeFormat),
+	} {
+		var requests int32
+		b := &testBackoff{delay: time.Hour}
+		client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&requests, 1) == 1 {
+				w.Header().Set("Retry-After", retryAfter)
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.Write([]byte(`{"BTCPrice":4000}`))
+		}, WithRetryBudget(10, time.Minute), WithBackoff(b), WithMaxRetryAfter(time.Millisecond*100))
+		start := time.Now()
+		if _, err := client.Global(); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if elapsed := time.Since(start); elapsed < time.Millisecond*100 || elapsed > time.Second*5 {
+			t.Errorf("%s: expected the retry after 100ms, got %v", name, elapsed)
+		}
+		if attempts, _ := b.state(); len(attempts) != 0 {
+			t.Errorf("%s: backoff must not be used, got %v", name, attempts)
+		}
+	}
+}
+
+func TestRetryAfterStatusError(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	_, err := client.Global()
+	var statusErr *HTTPStatusError
+	if !errors.As(err, &statusErr) || statusErr.RetryAfter != time.Second*7 {
+		t.Errorf("expected retry after 7s, got %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// sharedRequests keeps contexts of requests shared by concurrent loads of the same path.
+// A shared request does not depend on the context of any single caller: it is canceled only after all callers,
+// which wait for it, have left. The zero value is ready to use.
+type sharedRequests struct {
+	mut      sync.Mutex
+	requests map[string]*sharedRequest
+}
+
+type sharedRequest struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	waiters int
+}
+
+// join registers a caller waiting for path. If there is no shared request for path, it is created with newCtx.
+func (s *sharedRequests) join(path string, newCtx func() (context.Context, context.CancelFunc)) *sharedRequest {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	req, found := s.requests[path]
+	if !found {
+		if s.requests == nil {
+			s.requests = make(map[string]*sharedRequest)
+		}
+		req = &sharedRequest{}
+		req.ctx, req.cancel = newCtx()
+		s.requests[path] = req
+	}
+	req.waiters++
+	return req
+}
+
+// leave unregisters a caller of path. The last caller cancels the request, and makes group forget it,
+// so that callers, which come later, start a new request instead of waiting for the canceled one.
+func (s *sharedRequests) leave(path string, req *sharedRequest, group *singleflight.Group) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if req.waiters--; req.waiters > 0 {
+		return
+	}
+	req.cancel()
+	delete(s.requests, path)
+	group.Forget(path)
+}
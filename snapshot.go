@@ -0,0 +1,56 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"context"
+	"strings"
+)
+
+// MarketSnapshot contains market-wide stats and the list of coins, requested at the same time.
+type MarketSnapshot struct {
+	Global
+	Front []Front
+}
+
+// SnapshotError is returned by Snapshot, if some of its requests failed.
+// Errors of successful requests are nil.
+type SnapshotError struct {
+	Global error
+	Front  error
+}
+
+func (e *SnapshotError) Error() string {
+	var parts []string
+	if e.Global != nil {
+		parts = append(parts, "global: "+e.Global.Error())
+	}
+	if e.Front != nil {
+		parts = append(parts, "front: "+e.Front.Error())
+	}
+	return "snapshot failed: " + strings.Join(parts, "; ")
+}
+
+// Snapshot requests /global and /front paths in parallel.
+// If one of the requests failed, the snapshot is returned with the corresponding part empty,
+// together with *SnapshotError. If both failed, the snapshot is nil.
+func (c *Client) Snapshot(ctx context.Context) (*MarketSnapshot, error) {
+	var snapshot MarketSnapshot
+	var snapErr SnapshotError
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		snapshot.Front, snapErr.Front = c.front(ctx, "front")
+	}()
+	if snapshot.Global, snapErr.Global = c.GlobalContext(ctx); snapErr.Global != nil {
+		snapshot.Global = Global{}
+	}
+	<-done
+	switch {
+	case snapErr.Global != nil && snapErr.Front != nil:
+		return nil, &snapErr
+	case snapErr.Global != nil || snapErr.Front != nil:
+		return &snapshot, &snapErr
+	}
+	return &snapshot, nil
+}
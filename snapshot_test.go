@@ -0,0 +1,70 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestSnapshot(t *testing.T) {
+	var failGlobal, failFront int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/global":
+			if atomic.LoadInt32(&failGlobal) == 1 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Write([]byte(`{"btcPrice":4000,"totalCap":150000000000}`))
+		case "/front":
+			if atomic.LoadInt32(&failFront) == 1 {
+				w.Write([]byte(`garbage`))
+				return
+			}
+			w.Write([]byte(`[{"short":"BTC","price":4000},{"short":"ETH","price":300}]`))
+		}
+	})
+	snap, err := client.Snapshot(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.BTCPrice != "4000" || len(snap.Front) != 2 || snap.Front[1].Short != "ETH" {
+		t.Errorf("unexpected snapshot %+v", snap)
+	}
+
+	atomic.StoreInt32(&failGlobal, 1)
+	snap, err = client.Snapshot(context.Background())
+	snapErr, ok := err.(*SnapshotError)
+	if !ok {
+		t.Fatalf("expected snapshot error, got %v", err)
+	}
+	if !errors.Is(snapErr.Global, ErrHTTPStatus) || snapErr.Front != nil {
+		t.Errorf("expected global to fail, got %v", snapErr)
+	}
+	if snap == nil || len(snap.BTCPrice) != 0 || len(snap.Front) != 2 {
+		t.Errorf("unexpected partial snapshot %+v", snap)
+	}
+
+	atomic.StoreInt32(&failGlobal, 0)
+	atomic.StoreInt32(&failFront, 1)
+	snap, err = client.Snapshot(context.Background())
+	if snapErr, ok = err.(*SnapshotError); !ok {
+		t.Fatalf("expected snapshot error, got %v", err)
+	}
+	if !errors.Is(snapErr.Front, ErrDecode) || snapErr.Global != nil {
+		t.Errorf("expected front to fail, got %v", snapErr)
+	}
+	if snap == nil || snap.BTCPrice != "4000" || snap.Front != nil {
+		t.Errorf("unexpected partial snapshot %+v", snap)
+	}
+
+	atomic.StoreInt32(&failGlobal, 1)
+	if snap, err = client.Snapshot(context.Background()); err == nil || snap != nil {
+		t.Errorf("expected both parts to fail, got %+v, %v", snap, err)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrStreamClosed is returned by TradeStream.Next after the stream is closed.
+var ErrStreamClosed = errors.New("stream closed")
+
+// tradeStreamBuffer is the number of trades a TradeStream buffers until Next is called.
+const tradeStreamBuffer = 64
+
+// TradeStream is a pull-based wrapper around a trades subscription.
+// It reconnects automatically on websocket errors and disconnects.
+type TradeStream struct {
+	trades    chan *Trade
+	stopChan  chan bool
+	done      chan struct{}
+	err       error
+	closeOnce sync.Once
+}
+
+// TradeStream starts a trades subscription and returns a stream to read trades from.
+// The stream must be closed with Close, when it is no longer needed.
+func (c *Client) TradeStream() *TradeStream {
+	s := &TradeStream{
+		trades:   make(chan *Trade, tradeStreamBuffer),
+		stopChan: make(chan bool),
+		done:     make(chan struct{}),
+	}
+	// errors are not read, so they are dropped, but make the subscription reconnect instead of failing.
+	errChan := make(chan error)
+	go func() {
+		s.err = c.SubscribeTradesWithErrors(s.trades, s.stopChan, errChan)
+		close(s.done)
+	}()
+	return s
+}
+
+// Next returns the next trade. It blocks until a trade arrives, ctx is done, or the stream terminates.
+// If the subscription failed, Next returns its error, after the stream is closed it returns ErrStreamClosed.
+func (s *TradeStream) Next(ctx context.Context) (*Trade, error) {
+	select {
+	case trade := <-s.trades:
+		return trade, nil
+	case <-s.done:
+		if s.err != nil {
+			return nil, s.err
+		}
+		return nil, ErrStreamClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops the subscription and waits for it to terminate. It is safe to call Close several times.
+func (s *TradeStream) Close() {
+	s.closeOnce.Do(func() {
+		close(s.stopChan)
+	})
+	<-s.done
+}
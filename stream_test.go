@@ -0,0 +1,59 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	gosio "github.com/graarh/golang-socketio"
+)
+
+func TestTradeStream(t *testing.T) {
+	client := New()
+	newTestWsServer(t, client, func(ch *gosio.Channel) {
+		emitTrades(ch, 3)
+	})
+	stream := client.TradeStream()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	defer cancel()
+	for i := 0; i < 3; i++ {
+		trade, err := stream.Next(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if trade.Data.MarketID == "" {
+			t.Errorf("%d: unexpected trade %+v", i, trade)
+		}
+	}
+	stream.Close()
+	stream.Close()
+	if _, err := stream.Next(ctx); err != ErrStreamClosed {
+		t.Errorf("expected ErrStreamClosed, got %v", err)
+	}
+}
+
+func TestTradeStreamError(t *testing.T) {
+	client := New()
+	client.Close()
+	stream := client.TradeStream()
+	defer stream.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := stream.Next(ctx); err != ErrClosed {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestTradeStreamContext(t *testing.T) {
+	client := New()
+	newTestWsServer(t, client, func(ch *gosio.Channel) {})
+	stream := client.TradeStream()
+	defer stream.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	if _, err := stream.Next(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline error, got %v", err)
+	}
+}
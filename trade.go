@@ -0,0 +1,162 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// FillType is a fill type of a trade. Values other than FillType* consts may be received as well.
+type FillType string
+
+// FillType* consts are known fill types.
+const (
+	FillTypeFill        FillType = "FILL"
+	FillTypePartialFill FillType = "PARTIAL_FILL"
+)
+
+// Known returns true, if t is one of FillType* consts.
+func (t FillType) Known() bool {
+	switch t {
+	case FillTypeFill, FillTypePartialFill:
+		return true
+	}
+	return false
+}
+
+// OrderType is an order type of a trade. Values other than OrderType* consts may be received as well.
+type OrderType string
+
+// OrderType* consts are known order types.
+const (
+	OrderTypeBuy  OrderType = "BUY"
+	OrderTypeSell OrderType = "SELL"
+)
+
+// Known returns true, if t is one of OrderType* consts.
+func (t OrderType) Known() bool {
+	switch t {
+	case OrderTypeBuy, OrderTypeSell:
+		return true
+	}
+	return false
+}
+
+const timestampNoZone = "2006-01-02T15:04:05.999999999"
+
+// Timestamp is a time, which coincap may send either as epoch milliseconds, or as an RFC3339 string.
+// Strings without a time zone, like "2017-09-13T14:12:25.67", are treated as UTC,
+// numeric strings are treated as epoch milliseconds. It is marshaled as an RFC3339 string.
+type Timestamp struct {
+	time.Time
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (ts *Timestamp) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if string(data) == "null" {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		str, err := strconv.Unquote(string(data))
+		if err != nil {
+			return errors.Wrap(err, "invalid timestamp string")
+		}
+		if len(str) == 0 {
+			ts.Time = time.Time{}
+			return nil
+		}
+		for _, layout := range []string{time.RFC3339Nano, timestampNoZone} {
+			if t, err := time.Parse(layout, str); err == nil {
+				ts.Time = t
+				return nil
+			}
+		}
+		data = []byte(str)
+	}
+	ms, err := json.Number(data).Float64()
+	if err != nil {
+		return errors.Errorf("invalid timestamp %s", data)
+	}
+	ts.Time = msToTime(int64(ms))
+	return nil
+}
+
+func msToTime(ms int64) time.Time {
+	return time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond))
+}
+
+// Time returns TimestampMs as time.Time.
+func (t TradeData) Time() time.Time {
+	return msToTime(t.TimestampMs)
+}
+
+// Notional returns the notional value of the trade in the quote currency.
+// Raw.Total is used, if present, otherwise it is computed as price * Raw.Quantity,
+// where price is Raw.Price, or Price, if the raw one is empty.
+// If the quantity or both prices are empty, an error wrapping ErrEmptyValue is returned.
+func (t TradeData) Notional() (float64, error) {
+	if len(t.Raw.Total) > 0 {
+		return parseNumber("total", t.Raw.Total)
+	}
+	price := t.Raw.Price
+	if len(price) == 0 {
+		price = t.Price
+	}
+	p, err := parseNumber("price", price)
+	if err != nil {
+		return 0, err
+	}
+	q, err := parseNumber("quantity", t.Raw.Quantity)
+	if err != nil {
+		return 0, err
+	}
+	return p * q, nil
+}
+
+// price returns Data.Price, or Msg.Msg.Price, if the trade has no data.
+func (t *Trade) price() (float64, error) {
+	if t.HasData && len(t.Data.Price) > 0 {
+		return parseNumber("price", t.Data.Price)
+	}
+	return parseNumber("price", t.Msg.Msg.Price)
+}
+
+// decodeTradeData decodes 'trade' field of a websocket message, which contains trade data in 'data' field.
+// It returns false, if the field or its data is missing, or null, and an error, if they can't be decoded.
+func decodeTradeData(raw json.RawMessage, decoder Decoder) (TradeData, bool, error) {
+	var trade struct {
+		Data *TradeData
+	}
+	if len(raw) == 0 {
+		return TradeData{}, false, nil
+	}
+	if err := decoder.Unmarshal(raw, &trade); err != nil {
+		return TradeData{}, false, err
+	}
+	if trade.Data == nil {
+		return TradeData{}, false, nil
+	}
+	return *trade.Data, true, nil
+}
+
+// Skew returns the difference between the local time and the trade time: Data.TimestampMs,
+// or Data.Raw.TimeStamp, if the former is empty. A positive value means, that the trade is in the past,
+// a negative one, that the local clock is behind. If the trade has no time, 0 is returned.
+func (t *Trade) Skew() time.Duration {
+	var ts time.Time
+	switch {
+	case t.Data.TimestampMs != 0:
+		ts = t.Data.Time()
+	case !t.Data.Raw.TimeStamp.IsZero():
+		ts = t.Data.Raw.TimeStamp.Time
+	default:
+		return 0
+	}
+	return time.Since(ts)
+}
@@ -0,0 +1,125 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestTimestamp(t *testing.T) {
+	expected := time.Date(2017, 9, 13, 14, 12, 25, 678000000, time.UTC)
+	for _, data := range []string{
+		`1505311945678`,
+		`"1505311945678"`,
+		`1.505311945678e12`,
+		`"2017-09-13T14:12:25.678Z"`,
+		`"2017-09-13T17:12:25.678+03:00"`,
+		`"2017-09-13T14:12:25.678"`,
+	} {
+		var ts Timestamp
+		if err := json.Unmarshal([]byte(data), &ts); err != nil {
+			t.Errorf("%s: %v", data, err)
+		} else if !ts.Equal(expected) {
+			t.Errorf("%s: expected %v, got %v", data, expected, ts.UTC())
+		}
+	}
+	for _, data := range []string{`null`, `""`} {
+		var ts Timestamp
+		if err := json.Unmarshal([]byte(data), &ts); err != nil {
+			t.Errorf("%s: %v", data, err)
+		} else if !ts.IsZero() {
+			t.Errorf("%s: expected zero time, got %v", data, ts)
+		}
+	}
+	var ts Timestamp
+	if err := json.Unmarshal([]byte(`"yesterday"`), &ts); err == nil {
+		t.Error("expected an error for invalid timestamp")
+	}
+}
+
+func TestTradeDataTime(t *testing.T) {
+	var data TradeData
+	payload := `{"timestamp_ms":1505311945678,"raw":{"TimeStamp":"2017-09-13T14:12:25.678Z"}}`
+	if err := json.Unmarshal([]byte(payload), &data); err != nil {
+		t.Error(err)
+		return
+	}
+	if !data.Time().Equal(data.Raw.TimeStamp.Time) {
+		t.Errorf("times differ: %v and %v", data.Time(), data.Raw.TimeStamp)
+	}
+}
+
+func TestTradeTypes(t *testing.T) {
+	for _, tc := range []struct {
+		payload   string
+		fillType  FillType
+		orderType OrderType
+		known     bool
+	}{
+		{payload: `{"FillType":"FILL","OrderType":"BUY"}`, fillType: FillTypeFill, orderType: OrderTypeBuy, known: true},
+		{payload: `{"FillType":"PARTIAL_FILL","OrderType":"SELL"}`, fillType: FillTypePartialFill, orderType: OrderTypeSell, known: true},
+		{payload: `{"FillType":"SOMETHING","OrderType":"SHORT"}`, fillType: "SOMETHING", orderType: "SHORT"},
+	} {
+		var data TradeData
+		if err := json.Unmarshal([]byte(`{"raw":`+tc.payload+`}`), &data); err != nil {
+			t.Error(err)
+			continue
+		}
+		if data.Raw.FillType != tc.fillType || data.Raw.OrderType != tc.orderType {
+			t.Errorf("%s: unexpected types %q, %q", tc.payload, data.Raw.FillType, data.Raw.OrderType)
+		}
+		if data.Raw.FillType.Known() != tc.known || data.Raw.OrderType.Known() != tc.known {
+			t.Errorf("%s: expected known = %v", tc.payload, tc.known)
+		}
+	}
+}
+
+func TestTradeNotional(t *testing.T) {
+	for _, tc := range []struct {
+		data     string
+		expected float64
+		empty    bool
+	}{
+		{data: `{"price":4000,"raw":{"Quantity":"0.5","Price":"4000","Total":"2001.5"}}`, expected: 2001.5},
+		{data: `{"price":4000,"raw":{"Quantity":"0.5","Price":"4100"}}`, expected: 2050},
+		{data: `{"price":4000,"raw":{"Quantity":0.25}}`, expected: 1000},
+		{data: `{"price":4000,"raw":{}}`, empty: true},
+		{data: `{"raw":{"Quantity":1}}`, empty: true},
+	} {
+		var data TradeData
+		if err := json.Unmarshal([]byte(tc.data), &data); err != nil {
+			t.Errorf("%s: %v", tc.data, err)
+			continue
+		}
+		val, err := data.Notional()
+		if tc.empty {
+			if !errors.Is(err, ErrEmptyValue) {
+				t.Errorf("%s: expected ErrEmptyValue, got %v", tc.data, err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v", tc.data, err)
+		} else if val != tc.expected {
+			t.Errorf("%s: expected %v, got %v", tc.data, tc.expected, val)
+		}
+	}
+}
+
+func TestTradeSkew(t *testing.T) {
+	now := time.Now()
+	past, future := &Trade{}, &Trade{}
+	past.Data.TimestampMs = now.Add(-time.Minute).UnixNano() / 1e6
+	future.Data.Raw.TimeStamp.Time = now.Add(time.Minute)
+	if skew := past.Skew(); skew < time.Minute || skew > time.Minute+time.Second {
+		t.Errorf("unexpected past skew %v", skew)
+	}
+	if skew := future.Skew(); skew > -time.Minute+time.Second || skew < -time.Minute {
+		t.Errorf("unexpected future skew %v", skew)
+	}
+	if skew := (&Trade{}).Skew(); skew != 0 {
+		t.Errorf("expected no skew, got %v", skew)
+	}
+}
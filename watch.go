@@ -0,0 +1,56 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// WatchGlobal polls /global path every interval, starting immediately, and sends the replies to the returned channel.
+// Failed requests are sent to the error channel, and polling continues.
+// Polling stops, when ctx is done. Both channels are closed after that.
+// The next request is made only after the previous result is received, so a slow reader never gets stale data.
+// If interval is not positive, the error is sent to the error channel, and both channels are closed.
+func (c *Client) WatchGlobal(ctx context.Context, interval time.Duration) (<-chan Global, <-chan error) {
+	globalChan, errChan := make(chan Global), make(chan error, 1)
+	if interval <= 0 {
+		errChan <- errors.Errorf("invalid interval %v", interval)
+		close(errChan)
+		close(globalChan)
+		return globalChan, errChan
+	}
+	go func() {
+		defer close(errChan)
+		defer close(globalChan)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			gl, err := c.GlobalContext(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				select {
+				case errChan <- err:
+				case <-ctx.Done():
+					return
+				}
+			} else {
+				select {
+				case globalChan <- gl:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return globalChan, errChan
+}
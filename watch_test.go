@@ -0,0 +1,71 @@
+// Copyright 2017 Aleksandr Demakin. All rights reserved.
+
+package coincap
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatchGlobal(t *testing.T) {
+	var requests int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 2 {
+			w.Write([]byte(`garbage`))
+			return
+		}
+		w.Write([]byte(`{"BTCPrice":4000}`))
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	globalChan, errChan := client.WatchGlobal(ctx, time.Millisecond*20)
+	var globals, errs int
+	for globals < 3 {
+		select {
+		case gl := <-globalChan:
+			if gl.BTCPrice != "4000" {
+				t.Errorf("unexpected price %q", gl.BTCPrice)
+			}
+			globals++
+		case <-errChan:
+			errs++
+		case <-time.After(time.Second):
+			t.Fatalf("only %d updates received", globals)
+		}
+	}
+	if errs != 1 {
+		t.Errorf("expected 1 error, got %d", errs)
+	}
+	cancel()
+	for globalChan != nil || errChan != nil {
+		select {
+		case _, ok := <-globalChan:
+			if !ok {
+				globalChan = nil
+			}
+		case _, ok := <-errChan:
+			if !ok {
+				errChan = nil
+			}
+		case <-time.After(time.Second):
+			t.Fatal("channels were not closed")
+		}
+	}
+}
+
+func TestWatchGlobalInvalidInterval(t *testing.T) {
+	client := New()
+	globalChan, errChan := client.WatchGlobal(context.Background(), 0)
+	if err := <-errChan; err == nil {
+		t.Error("expected an error")
+	}
+	if _, ok := <-errChan; ok {
+		t.Error("error channel was not closed")
+	}
+	if _, ok := <-globalChan; ok {
+		t.Error("global channel was not closed")
+	}
+}